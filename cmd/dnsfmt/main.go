@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/vooon/zoneomatic/internal/buildinfo"
@@ -12,11 +14,12 @@ import (
 )
 
 type Cli struct {
-	Origin  string           `short:"o" name:"origin" help:"set the origin, otherwise taken from $ORIGIN or the owner name of the SOA record."`
-	Inc     bool             `short:"i" name:"inc" default:"true" negatable:"" help:"increase the serial, default: ${default}"`
-	Replace bool             `short:"r" name:"replace" help:"Replace file with formatted output"`
-	Files   []string         `arg:"" optional:"" placeholder:"FILE" type:"existingfile" help:"Zone file, use stdin if it is '-' or empty"`
-	Version kong.VersionFlag `help:"Print version and exit"`
+	Origin      string           `short:"o" name:"origin" help:"set the origin, otherwise taken from $ORIGIN or the owner name of the SOA record."`
+	Inc         bool             `short:"i" name:"inc" default:"true" negatable:"" help:"increase the serial, default: ${default}"`
+	Replace     bool             `short:"r" name:"replace" help:"Replace file with formatted output"`
+	LockTimeout time.Duration    `name:"lock-timeout" default:"10s" help:"Wait for the zone file lock, taken with --replace, default: ${default}"`
+	Files       []string         `arg:"" optional:"" placeholder:"FILE" type:"existingfile" help:"Zone file, use stdin if it is '-' or empty"`
+	Version     kong.VersionFlag `help:"Print version and exit"`
 }
 
 func main() {
@@ -38,6 +41,12 @@ func main() {
 	}
 
 	for _, a := range cli.Files {
+		if cli.Replace {
+			err := replaceFile(a, []byte(cli.Origin), cli.Inc, cli.LockTimeout)
+			kctx.FatalIfErrorf(err)
+			continue
+		}
+
 		data, err := os.ReadFile(a)
 		kctx.FatalIfErrorf(err)
 
@@ -46,12 +55,30 @@ func main() {
 		err = dnsfmt.Reformat(data, []byte(cli.Origin), buf, cli.Inc)
 		kctx.FatalIfErrorf(err)
 
-		if cli.Replace {
-			err = fileutil.AtomicWriteFile(a, buf.Bytes())
-			kctx.FatalIfErrorf(err)
-		} else {
-			_, err = io.Copy(os.Stdout, buf)
-			kctx.FatalIfErrorf(err)
-		}
+		_, err = io.Copy(os.Stdout, buf)
+		kctx.FatalIfErrorf(err)
 	}
 }
+
+// replaceFile formats the file in place, holding the same lock as zoneomatic,
+// so a concurrent update is not lost.
+func replaceFile(filename string, origin []byte, inc bool, lockTimeout time.Duration) error {
+	unlock, err := fileutil.Lock(context.Background(), filename, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock() // nolint:errcheck
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = dnsfmt.Reformat(data, origin, buf, inc)
+	if err != nil {
+		return err
+	}
+
+	return fileutil.AtomicWriteFile(filename, buf.Bytes())
+}
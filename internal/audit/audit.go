@@ -0,0 +1,209 @@
+// Package audit keeps an append-only log of zone changes.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// maxLineSize limits an entry line read by Find
+const maxLineSize = 1 << 20
+
+// Entry is a change of one RRset.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// User, Token and Issuer are the authenticated identity, see htpasswd.Identity
+	User     string `json:"user,omitempty"`
+	Token    string `json:"token_id,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	ClientIP string `json:"client_ip,omitempty"`
+	// Endpoint is the endpoint family: ddns, acme, zm or pdns
+	Endpoint string `json:"endpoint"`
+	Zone     string `json:"zone"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	// Old and New are record values, disabled records are prefixed with `disabled:`
+	Old       []string `json:"old"`
+	New       []string `json:"new"`
+	OldSerial uint32   `json:"old_serial"`
+	NewSerial uint32   `json:"new_serial"`
+	TraceID   string   `json:"trace_id,omitempty"`
+}
+
+// Logger records zone changes.
+type Logger interface {
+	Log(ctx context.Context, entries ...Entry) error
+}
+
+// Querier finds recorded changes.
+type Querier interface {
+	// Find returns up to limit last changes of the name, newest first. Empty typ matches any type.
+	Find(name, typ string, limit int) ([]Entry, error)
+}
+
+// Option configures FileLog.
+type Option func(*FileLog)
+
+// WithOTelLogs also emits entries as OpenTelemetry log records.
+func WithOTelLogs() Option {
+	return func(l *FileLog) {
+		l.otel = global.GetLoggerProvider().Logger("github.com/vooon/zoneomatic/internal/audit")
+	}
+}
+
+// FileLog appends entries as JSON lines to a file.
+type FileLog struct {
+	path string
+	otel otellog.Logger
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens the log file for appending, it is created if missing.
+func Open(filename string, opts ...Option) (*FileLog, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &FileLog{path: filename, f: f}
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	return ret, nil
+}
+
+// Close closes the file.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Close()
+}
+
+// Log implements Logger. Entries are written at once and synced to disk.
+func (l *FileLog) Log(ctx context.Context, entries ...Entry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	_, err := l.f.Write(buf.Bytes())
+	if err == nil {
+		err = l.f.Sync()
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+
+	if l.otel != nil {
+		for _, e := range entries {
+			l.otel.Emit(ctx, e.record())
+		}
+	}
+
+	return nil
+}
+
+// Find implements Querier.
+func (l *FileLog) Find(name, typ string, limit int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+
+	name = dns.CanonicalName(name)
+	typ = strings.ToUpper(typ)
+
+	// keep the last limit entries in a ring
+	ring := make([]Entry, 0, limit)
+	next := 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// a torn last line after a crash is not fatal
+			continue
+		}
+		if dns.CanonicalName(e.Name) != name || (typ != "" && e.Type != typ) {
+			continue
+		}
+
+		if len(ring) < limit {
+			ring = append(ring, e)
+			continue
+		}
+		ring[next] = e
+		next = (next + 1) % limit
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return nil, err
+	}
+
+	ret := make([]Entry, 0, len(ring))
+	for i := range ring {
+		ret = append(ret, ring[(next+len(ring)-1-i)%len(ring)])
+	}
+
+	return ret, nil
+}
+
+func (e Entry) record() otellog.Record {
+	var rec otellog.Record
+	rec.SetEventName("zoneomatic.audit")
+	rec.SetTimestamp(e.Time)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue(fmt.Sprintf("%s %s changed by %s", e.Name, e.Type, e.User)))
+	rec.AddAttributes(
+		otellog.String("user", e.User),
+		otellog.String("token_id", e.Token),
+		otellog.String("issuer", e.Issuer),
+		otellog.String("client_ip", e.ClientIP),
+		otellog.String("endpoint", e.Endpoint),
+		otellog.String("zone.name", e.Zone),
+		otellog.String("dns.rr.name", e.Name),
+		otellog.String("dns.rr.type", e.Type),
+		otellog.Slice("old", stringValues(e.Old)...),
+		otellog.Slice("new", stringValues(e.New)...),
+		otellog.Int64("old_serial", int64(e.OldSerial)),
+		otellog.Int64("new_serial", int64(e.NewSerial)),
+		otellog.String("trace_id", e.TraceID),
+	)
+
+	return rec
+}
+
+func stringValues(values []string) []otellog.Value {
+	ret := make([]otellog.Value, 0, len(values))
+	for _, v := range values {
+		ret = append(ret, otellog.StringValue(v))
+	}
+
+	return ret
+}
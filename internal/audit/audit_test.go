@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	ctx := context.Background()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := func(name, typ string, serial uint32) Entry {
+		return Entry{Time: now, User: "u", Endpoint: "zm", Zone: "example.com.", Name: name, Type: typ,
+			Old: []string{}, New: []string{"192.0.2.1"}, OldSerial: serial, NewSerial: serial + 1}
+	}
+
+	require.NoError(t, l.Log(ctx, entry("a.example.com.", "A", 1), entry("a.example.com.", "TXT", 1)))
+	require.NoError(t, l.Log(ctx, entry("b.example.com.", "A", 2)))
+	require.NoError(t, l.Log(ctx, entry("a.example.com.", "A", 3)))
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	got, err := l.Find("A.Example.COM", "a", 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, entry("a.example.com.", "A", 3), got[0])
+
+	got, err = l.Find("a.example.com.", "", 10)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, []uint32{3, 1, 1}, []uint32{got[0].OldSerial, got[1].OldSerial, got[2].OldSerial})
+	assert.Equal(t, "TXT", got[1].Type)
+
+	got, err = l.Find("a.example.com.", "", 2)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "A", got[0].Type)
+	assert.Equal(t, "TXT", got[1].Type)
+
+	got, err = l.Find("missing.example.com.", "", 1)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// reopen appends
+	require.NoError(t, l.Close())
+	l, err = Open(path)
+	require.NoError(t, err)
+	require.NoError(t, l.Log(ctx, entry("b.example.com.", "A", 4)))
+
+	got, err = l.Find("b.example.com.", "A", 5)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, uint32(4), got[0].OldSerial)
+}
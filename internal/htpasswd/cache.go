@@ -0,0 +1,110 @@
+package htpasswd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the cache, it is cleared when full of live entries
+const maxCacheEntries = 4096
+
+// WithCacheTTL caches successful password verifications for ttl, 0 disables the cache.
+// Slow hashes like bcrypt are checked once per ttl for the same user and password.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(s *HTPasswdFile) {
+		if ttl > 0 {
+			s.cache = newVerifyCache(ttl)
+		}
+	}
+}
+
+type cacheKey [sha256.Size]byte
+
+type cacheEntry struct {
+	// hash the password was verified against, changed hash misses the cache
+	hash    string
+	expires time.Time
+}
+
+// verifyCache keeps successful verifications.
+// Keys are HMAC of user and password with a random per-process key, plaintext is never stored.
+type verifyCache struct {
+	ttl    time.Duration
+	secret []byte
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+func newVerifyCache(ttl time.Duration) *verifyCache {
+	secret := make([]byte, sha256.Size)
+	_, _ = rand.Read(secret)
+
+	return &verifyCache{
+		ttl:     ttl,
+		secret:  secret,
+		now:     time.Now,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+func (c *verifyCache) key(user, password string) cacheKey {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(user))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+
+	var ret cacheKey
+	mac.Sum(ret[:0])
+	return ret
+}
+
+// verified checks if the password was verified against the hash recently.
+func (c *verifyCache) verified(user, password, hash string) bool {
+	key := c.key(user, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if e.hash != hash || !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return false
+	}
+
+	return true
+}
+
+func (c *verifyCache) add(user, password, hash string) {
+	key := c.key(user, password)
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			clear(c.entries)
+		}
+	}
+
+	c.entries[key] = cacheEntry{hash: hash, expires: now.Add(c.ttl)}
+}
+
+func (c *verifyCache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+}
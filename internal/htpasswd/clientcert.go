@@ -0,0 +1,49 @@
+package htpasswd
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// Client certificate fields to map to the user name
+const (
+	CertUserCN       = "cn"
+	CertUserSANDNS   = "san-dns"
+	CertUserSANEmail = "san-email"
+)
+
+// WithClientCerts authenticates requests with a verified TLS client certificate,
+// when no other credentials are present. The field is one of CertUser*.
+func WithClientCerts(field string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.certField = field
+	}
+}
+
+// clientCertUser returns the user name of the verified client certificate.
+func clientCertUser(r *http.Request, field string) (string, bool) {
+	if field == "" || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	user := CertUser(r.TLS.VerifiedChains[0][0], field)
+	return user, user != ""
+}
+
+// CertUser maps the certificate field to the user name.
+func CertUser(cert *x509.Certificate, field string) string {
+	switch field {
+	case CertUserSANDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case CertUserSANEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
@@ -0,0 +1,135 @@
+package htpasswd
+
+import (
+	"crypto/sha1" // nolint:gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GehirnInc/crypt"
+	_ "github.com/GehirnInc/crypt/apr1_crypt"
+	_ "github.com/GehirnInc/crypt/sha256_crypt"
+	_ "github.com/GehirnInc/crypt/sha512_crypt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMalformedHash   = errors.New("malformed hash")
+	ErrUnsupportedHash = errors.New("unsupported hash format")
+)
+
+type hashFormat struct {
+	name string
+	// weak formats are accepted, but logged at load
+	weak bool
+	// insecure formats are rejected unless explicitly allowed
+	insecure bool
+	// unsupported formats are always rejected and logged at load
+	unsupported bool
+	verify      func(hash, password string) (bool, error)
+}
+
+var (
+	formatBcrypt   = hashFormat{name: "bcrypt", verify: verifyBcrypt}
+	formatArgon2id = hashFormat{name: "argon2id", verify: verifyArgon2id}
+	formatSHA512   = hashFormat{name: "sha512-crypt", verify: verifyCrypt}
+	formatSHA256   = hashFormat{name: "sha256-crypt", verify: verifyCrypt}
+	formatAPR1     = hashFormat{name: "apr1", weak: true, verify: verifyCrypt}
+	formatSHA1     = hashFormat{name: "sha1", weak: true, insecure: true, verify: verifySHA1}
+	formatPlain    = hashFormat{name: "plain", weak: true, insecure: true, verify: verifyPlain}
+	// formatUnsupported is a hash of unknown scheme, e.g. $1$ MD5-crypt or {SSHA}, never a plaintext password
+	formatUnsupported = hashFormat{name: "unsupported", unsupported: true, verify: verifyUnsupported}
+)
+
+// detectHashFormat guesses the format by the hash prefix, like Apache htpasswd does.
+func detectHashFormat(hash string) hashFormat {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return formatBcrypt
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return formatArgon2id
+	case strings.HasPrefix(hash, "$6$"):
+		return formatSHA512
+	case strings.HasPrefix(hash, "$5$"):
+		return formatSHA256
+	case strings.HasPrefix(hash, "$apr1$"):
+		return formatAPR1
+	case strings.HasPrefix(hash, "{SHA}"):
+		return formatSHA1
+	case strings.HasPrefix(hash, "$"), strings.HasPrefix(hash, "{") && strings.Contains(hash, "}"):
+		return formatUnsupported
+	default:
+		return formatPlain
+	}
+}
+
+func verifyBcrypt(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil, err
+}
+
+func verifyCrypt(hash, password string) (bool, error) {
+	c := crypt.NewFromHash(hash)
+	if c == nil {
+		return false, ErrMalformedHash
+	}
+
+	err := c.Verify(hash, []byte(password))
+	if errors.Is(err, crypt.ErrKeyMismatch) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// verifyArgon2id checks PHC string: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+func verifyArgon2id(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("%w: unsupported argon2 version: %s", ErrMalformedHash, parts[2])
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+
+	if len(salt) == 0 || len(key) == 0 || threads == 0 {
+		return false, ErrMalformedHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func verifySHA1(hash, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) // nolint:gosec
+	expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1, nil
+}
+
+func verifyUnsupported(_, _ string) (bool, error) {
+	return false, ErrUnsupportedHash
+}
+
+func verifyPlain(hash, password string) (bool, error) {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1, nil
+}
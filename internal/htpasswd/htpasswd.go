@@ -2,54 +2,352 @@ package htpasswd
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+var (
+	ErrNoUsers      = errors.New("no users in htpasswd file")
+	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidUser  = errors.New("invalid user name")
 )
 
 type HTPasswd interface {
 	Authenticate(user, password string) (ok, present bool)
+	// HasUser checks the user exists, tokens of removed users are rejected by it
+	HasUser(user string) bool
+}
+
+// UserStore manages htpasswd users.
+type UserStore interface {
+	Users() []string
+	AddUser(user, password string) error
+	SetPassword(user, password string) error
+	DeleteUser(user string) error
+}
+
+// Option configures HTPasswdFile.
+type Option func(*HTPasswdFile)
+
+// WithBcryptCost sets the cost of new password hashes.
+func WithBcryptCost(cost int) Option {
+	return func(s *HTPasswdFile) {
+		s.bcryptCost = cost
+	}
 }
 
-type HTPasswdFile map[string]string
+// WithInsecureHashes allows plaintext and {SHA} passwords.
+func WithInsecureHashes(allow bool) Option {
+	return func(s *HTPasswdFile) {
+		s.allowInsecure = allow
+	}
+}
 
-func NewFromFile(filename string) (HTPasswd, error) {
+type HTPasswdFile struct {
+	path          string
+	allowInsecure bool
+	bcryptCost    int
+	cache         *verifyCache
+
+	// writeMu serializes file updates
+	writeMu sync.Mutex
+
+	mu    sync.RWMutex
+	users map[string]string
+}
 
-	ret := make(HTPasswdFile)
+func NewFromFile(filename string, opts ...Option) (*HTPasswdFile, error) {
 
-	fd, err := os.Open(filename)
+	ret := &HTPasswdFile{
+		path:       filename,
+		bcryptCost: bcrypt.DefaultCost,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	users, err := parseFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer fd.Close() // nolint:errcheck
 
-	scanner := bufio.NewScanner(fd)
+	ret.users = users
+	ret.logWeakHashes()
+
+	return ret, nil
+}
+
+func parseFile(filename string) (map[string]string, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUsers(buf), nil
+}
+
+func parseUsers(buf []byte) map[string]string {
+	users := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
 	for scanner.Scan() {
 		user, hash, ok := strings.Cut(scanner.Text(), ":")
 		if ok {
-			ret[user] = hash
+			users[user] = hash
 		}
 	}
 
-	return ret, nil
+	return users
+}
+
+// Reload reads the file again. On error current users are kept.
+// Empty file is also an error, as it likely caught in the middle of a write.
+func (s *HTPasswdFile) Reload() error {
+	users, err := parseFile(s.path)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoUsers, s.path)
+	}
+
+	s.mu.Lock()
+	added, removed, changed := diffKeys(s.users, users)
+	s.users = users
+	s.mu.Unlock()
+	s.clearCache()
+
+	slog.Info("htpasswd reloaded", "file", s.path, "users", len(users),
+		"added", added, "removed", removed, "changed", changed)
+	s.logWeakHashes()
+
+	return nil
 }
 
-func (s HTPasswdFile) Authenticate(user, password string) (ok bool, present bool) {
-	hash, present := s[user]
+func (s *HTPasswdFile) Authenticate(user, password string) (ok bool, present bool) {
+	s.mu.RLock()
+	hash, present := s.users[user]
+	s.mu.RUnlock()
 	if !present {
 		return false, false
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	ok = err == nil
+	// rejected users are logged once at load, see logWeakHashes
+	format := detectHashFormat(hash)
+	if format.unsupported || (format.insecure && !s.allowInsecure) {
+		return false, true
+	}
 
+	// failures are never cached, so they always take the hash time
+	if s.cache != nil && s.cache.verified(user, password, hash) {
+		return true, true
+	}
+
+	ok, err := format.verify(hash, password)
+	if ok && s.cache != nil {
+		s.cache.add(user, password, hash)
+	}
 	if err != nil && !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 		// Log that user's hash has unsupported format. Better than silently return 401.
-		slog.Warn("htpasswd bcrypt compare failed", "user", user)
+		slog.Warn("htpasswd hash compare failed", "user", user, "format", format.name, "error", err)
+	}
+
+	return ok, true
+}
+
+// HasUser implements HTPasswd.
+func (s *HTPasswdFile) HasUser(user string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[user]
+	return ok
+}
+
+// Users returns sorted user names.
+func (s *HTPasswdFile) Users() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(s.users))
+}
+
+// AddUser adds the user with bcrypt password hash.
+func (s *HTPasswdFile) AddUser(user, password string) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(users map[string]string) error {
+		if _, ok := users[user]; ok {
+			return fmt.Errorf("%w: %s", ErrUserExists, user)
+		}
+
+		users[user] = string(hash)
+		return nil
+	})
+}
+
+// SetPassword changes the user password, new hash is bcrypt.
+func (s *HTPasswdFile) SetPassword(user, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(users map[string]string) error {
+		if _, ok := users[user]; !ok {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, user)
+		}
+
+		users[user] = string(hash)
+		return nil
+	})
+}
+
+// DeleteUser removes the user.
+func (s *HTPasswdFile) DeleteUser(user string) error {
+	return s.update(func(users map[string]string) error {
+		if _, ok := users[user]; !ok {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, user)
+		}
+
+		delete(users, user)
+		return nil
+	})
+}
+
+// update applies fn to the users of the file and writes it atomically.
+// The file is read again to keep concurrent manual edits, other lines and order are preserved.
+func (s *HTPasswdFile) update(fn func(users map[string]string) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	users := parseUsers(buf)
+	if err := fn(users); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	written := make(map[string]bool, len(users))
+	for line := range strings.Lines(string(buf)) {
+		line = strings.TrimRight(line, "\r\n")
+		user, _, ok := strings.Cut(line, ":")
+		if !ok {
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		hash, present := users[user]
+		if present && !written[user] {
+			out.WriteString(user + ":" + hash + "\n")
+			written[user] = true
+		}
+	}
+	for _, user := range slices.Sorted(maps.Keys(users)) {
+		if !written[user] {
+			out.WriteString(user + ":" + users[user] + "\n")
+		}
+	}
+
+	if err := fileutil.AtomicWriteFile(s.path, out.Bytes()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	added, removed, changed := diffKeys(s.users, users)
+	s.users = users
+	s.mu.Unlock()
+	s.clearCache()
+
+	slog.Info("htpasswd updated", "file", s.path, "added", added, "removed", removed, "changed", changed)
+	return nil
+}
+
+func (s *HTPasswdFile) clearCache() {
+	if s.cache != nil {
+		s.cache.clear()
+	}
+}
+
+func validateUser(user string) error {
+	if user == "" || strings.ContainsAny(user, ":\r\n") || strings.TrimSpace(user) != user {
+		return fmt.Errorf("%w: %q", ErrInvalidUser, user)
+	}
+
+	return nil
+}
+
+// logWeakHashes warns once about users which hashes are weak or would be rejected.
+func (s *HTPasswdFile) logWeakHashes() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var weak, rejected, unsupported []string
+	for _, user := range slices.Sorted(maps.Keys(s.users)) {
+		format := detectHashFormat(s.users[user])
+		switch {
+		case format.unsupported:
+			unsupported = append(unsupported, user)
+		case format.insecure && !s.allowInsecure:
+			rejected = append(rejected, user)
+		case format.weak:
+			weak = append(weak, user)
+		}
+	}
+
+	if len(weak) > 0 {
+		slog.Warn("htpasswd users with weak password hashes, consider bcrypt or argon2id", "users", weak)
+	}
+	if len(rejected) > 0 {
+		slog.Warn("htpasswd users with plaintext or {SHA} passwords will be rejected", "users", rejected)
+	}
+	if len(unsupported) > 0 {
+		slog.Warn("htpasswd users with unsupported password hashes will be rejected", "users", unsupported)
+	}
+}
+
+// diffKeys returns sorted keys added to, removed from and changed in the new map.
+func diffKeys[V comparable](old, cur map[string]V) (added, removed, changed []string) {
+	for k, v := range cur {
+		ov, ok := old[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case ov != v:
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			removed = append(removed, k)
+		}
 	}
 
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
 	return
 }
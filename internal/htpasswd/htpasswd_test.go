@@ -1,10 +1,15 @@
 package htpasswd
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHTPasswdFile(t *testing.T) {
@@ -19,7 +24,15 @@ func TestHTPasswdFile(t *testing.T) {
 		{"ok", "test", "test", true, true},
 		{"wrong-pass", "test", "foobar", false, true},
 		{"no-user", "test2", "test", false, false},
-		{"apr1", "test-md5", "test", false, true},
+		{"apr1", "test-md5", "test", true, true},
+		{"apr1-wrong-pass", "test-md5", "foobar", false, true},
+		{"sha256-crypt", "test-sha256", "test", true, true},
+		{"sha512-crypt", "test-sha512", "test", true, true},
+		{"sha512-crypt-wrong-pass", "test-sha512", "foobar", false, true},
+		{"argon2id", "test-argon2", "test", true, true},
+		{"argon2id-wrong-pass", "test-argon2", "foobar", false, true},
+		{"sha1-not-allowed", "test-sha1", "test", false, true},
+		{"plain-not-allowed", "test-plain", "test", false, true},
 	}
 
 	ht, err := NewFromFile("./testdata/test.htpasswd")
@@ -33,3 +46,161 @@ func TestHTPasswdFile(t *testing.T) {
 		})
 	}
 }
+
+func TestHTPasswdFile_InsecureHashes(t *testing.T) {
+	ht, err := NewFromFile("./testdata/test.htpasswd", WithInsecureHashes(true))
+	require.NoError(t, err)
+
+	ok, _ := ht.Authenticate("test-sha1", "test")
+	assert.True(t, ok)
+	ok, _ = ht.Authenticate("test-sha1", "foobar")
+	assert.False(t, ok)
+	ok, _ = ht.Authenticate("test-plain", "test")
+	assert.True(t, ok)
+	ok, _ = ht.Authenticate("test-plain", "foobar")
+	assert.False(t, ok)
+}
+
+func TestHTPasswdFile_UnsupportedHashes(t *testing.T) {
+	hashes := map[string]string{
+		"md5-crypt":  "$1$salt$qJH7.N4xYta3aEG/dfqo/0",
+		"bcrypt-2x":  "$2x$05$/77wioH2oZQ0QVy4OaG9Peeq7ktpvDHiyL4G4C3mlCNOEERWoLJ2W",
+		"sha1-crypt": "$sha1$48000$salt$hash",
+		"ssha":       "{SSHA}2QOmgNXYyVRGa5BmKn54SO/ZUTAxMjM0",
+	}
+
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	buf := ""
+	for user, hash := range hashes {
+		buf += user + ":" + hash + "\n"
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(buf), 0600))
+
+	ht, err := NewFromFile(filename, WithInsecureHashes(true))
+	require.NoError(t, err)
+
+	for user, hash := range hashes {
+		t.Run(user, func(t *testing.T) {
+			assert.Equal(t, formatUnsupported.name, detectHashFormat(hash).name)
+
+			// the hash itself is not a plaintext password
+			ok, present := ht.Authenticate(user, hash)
+			assert.False(t, ok)
+			assert.True(t, present)
+		})
+	}
+
+	assert.Equal(t, formatPlain.name, detectHashFormat("secret").name)
+	assert.Equal(t, formatPlain.name, detectHashFormat("{secret").name)
+}
+
+func TestHTPasswdFile_Reload(t *testing.T) {
+	src, err := os.ReadFile("./testdata/test.htpasswd")
+	require.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	require.NoError(t, os.WriteFile(filename, src, 0600))
+
+	ht, err := NewFromFile(filename)
+	require.NoError(t, err)
+
+	// replace test-md5 by test-new, reuse the bcrypt hash of "test"
+	testLine := strings.Split(string(src), "\n")[1]
+	_, hash, _ := strings.Cut(testLine, ":")
+	require.NoError(t, os.WriteFile(filename, []byte(testLine+"\ntest-new:"+hash+"\n"), 0600))
+	require.NoError(t, ht.Reload())
+
+	assert.Equal(t, []string{"test", "test-new"}, ht.Users())
+	ok, _ := ht.Authenticate("test-new", "test")
+	assert.True(t, ok)
+	_, present := ht.Authenticate("test-md5", "test")
+	assert.False(t, present)
+
+	// broken or missing file keeps previous users
+	require.NoError(t, os.WriteFile(filename, nil, 0600))
+	assert.ErrorIs(t, ht.Reload(), ErrNoUsers)
+	require.NoError(t, os.Remove(filename))
+	assert.Error(t, ht.Reload())
+	assert.Equal(t, []string{"test", "test-new"}, ht.Users())
+}
+
+func TestHTPasswdFile_UserStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	bobHash, err := bcrypt.GenerateFromPassword([]byte("bob"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, []byte("# comment\nbob:"+string(bobHash)+"\n"), 0600))
+
+	ht, err := NewFromFile(filename, WithBcryptCost(bcrypt.MinCost))
+	require.NoError(t, err)
+
+	require.NoError(t, ht.AddUser("alice", "secret"))
+	assert.ErrorIs(t, ht.AddUser("alice", "other"), ErrUserExists)
+	assert.ErrorIs(t, ht.AddUser("bad:name", "secret"), ErrInvalidUser)
+	assert.Equal(t, []string{"alice", "bob"}, ht.Users())
+
+	ok, _ := ht.Authenticate("alice", "secret")
+	assert.True(t, ok)
+
+	require.NoError(t, ht.SetPassword("bob", "new"))
+	assert.ErrorIs(t, ht.SetPassword("carol", "new"), ErrUserNotFound)
+	ok, _ = ht.Authenticate("bob", "new")
+	assert.True(t, ok)
+
+	require.NoError(t, ht.DeleteUser("alice"))
+	assert.ErrorIs(t, ht.DeleteUser("alice"), ErrUserNotFound)
+
+	// the file keeps other lines and is read back the same
+	buf, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(buf), "# comment\nbob:$2a$"))
+
+	st, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	other, err := NewFromFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, other.Users())
+}
+
+func TestHTPasswdFile_Cache(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, []byte("alice:"+string(hash)+"\n"), 0600))
+
+	ht, err := NewFromFile(filename, WithCacheTTL(time.Minute), WithBcryptCost(bcrypt.MinCost))
+	require.NoError(t, err)
+	now := time.Now()
+	ht.cache.now = func() time.Time { return now }
+
+	ok, _ := ht.Authenticate("alice", "wrong")
+	assert.False(t, ok)
+	assert.Empty(t, ht.cache.entries, "failures are not cached")
+
+	ok, _ = ht.Authenticate("alice", "secret")
+	assert.True(t, ok)
+	assert.Len(t, ht.cache.entries, 1)
+	assert.True(t, ht.cache.verified("alice", "secret", string(hash)))
+	assert.False(t, ht.cache.verified("alice", "wrong", string(hash)))
+	assert.False(t, ht.cache.verified("bob", "secret", string(hash)))
+
+	// the plaintext is not kept
+	for _, e := range ht.cache.entries {
+		assert.NotContains(t, e.hash, "secret")
+	}
+
+	now = now.Add(time.Minute)
+	assert.False(t, ht.cache.verified("alice", "secret", string(hash)), "expired")
+
+	ok, _ = ht.Authenticate("alice", "secret")
+	assert.True(t, ok)
+	require.NoError(t, ht.Reload())
+	assert.Empty(t, ht.cache.entries, "reload clears the cache")
+
+	ok, _ = ht.Authenticate("alice", "secret")
+	assert.True(t, ok)
+	require.NoError(t, ht.SetPassword("alice", "new"))
+	ok, _ = ht.Authenticate("alice", "secret")
+	assert.False(t, ok, "old password is not accepted from the cache")
+}
@@ -0,0 +1,133 @@
+package htpasswd
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Endpoint families used in token scopes
+const (
+	EndpointDDNS = "ddns"
+	EndpointACME = "acme"
+	EndpointZM   = "zm"
+	EndpointPDNS = "pdns"
+	// EndpointAdmin must be listed explicitly, empty Endpoints do not allow it
+	EndpointAdmin = "admin"
+)
+
+// Scopes limit what a token can do. Empty list means no restriction.
+type Scopes struct {
+	// Endpoints is a list of allowed endpoint families (Endpoint* constants)
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Zones allows all names within the listed zones
+	Zones []string `json:"zones,omitempty"`
+	// Names allows the listed names, `*.example.com.` allows any name under example.com.
+	Names []string `json:"names,omitempty"`
+	// Sources is a list of allowed client networks
+	Sources []netip.Prefix `json:"sources,omitempty"`
+}
+
+// Identity is an authenticated client.
+type Identity struct {
+	User string
+	// Token is the token ID, empty for password authentication
+	Token string
+	// Issuer of the JWT, empty for other authentication methods
+	Issuer string
+	Scopes Scopes
+	// ClientIP is the client address, set by the middleware
+	ClientIP netip.Addr
+}
+
+type identityKey struct{}
+
+// WithIdentity stores the identity in the context.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity set by auth middlewares.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// AllowsEndpoint checks if the endpoint family is allowed.
+func (s Scopes) AllowsEndpoint(endpoint string) bool {
+	if endpoint == EndpointAdmin {
+		return slices.Contains(s.Endpoints, endpoint)
+	}
+
+	return len(s.Endpoints) == 0 || slices.Contains(s.Endpoints, endpoint)
+}
+
+// AllowsSource checks if the client address is allowed.
+func (s Scopes) AllowsSource(addr netip.Addr) bool {
+	return allowsSource(s.Sources, addr)
+}
+
+// AllowsName checks if the record name is allowed by Zones or Names.
+func (s Scopes) AllowsName(name string) bool {
+	if len(s.Zones) == 0 && len(s.Names) == 0 {
+		return true
+	}
+
+	name = canonicalName(name)
+	for _, z := range s.Zones {
+		if dns.IsSubDomain(canonicalName(z), name) {
+			return true
+		}
+	}
+	for _, n := range s.Names {
+		n = canonicalName(n)
+		if wild, ok := strings.CutPrefix(n, "*."); ok {
+			if name != wild && dns.IsSubDomain(wild, name) {
+				return true
+			}
+			continue
+		}
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsZone checks if anything in the zone is allowed.
+func (s Scopes) AllowsZone(zone string) bool {
+	if len(s.Zones) == 0 && len(s.Names) == 0 {
+		return true
+	}
+
+	zone = canonicalName(zone)
+	for _, z := range s.Zones {
+		if dns.IsSubDomain(canonicalName(z), zone) {
+			return true
+		}
+	}
+	for _, n := range s.Names {
+		n = strings.TrimPrefix(canonicalName(n), "*.")
+		if dns.IsSubDomain(zone, n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowsSource(sources []netip.Prefix, addr netip.Addr) bool {
+	if len(sources) == 0 {
+		return true
+	}
+
+	return addr.IsValid() && prefixesContain(addr.Unmap(), sources)
+}
+
+func canonicalName(name string) string {
+	return dns.CanonicalName(strings.TrimSpace(name))
+}
@@ -0,0 +1,263 @@
+package htpasswd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound       = errors.New("signing key not found")
+	ErrUnsupportedJWKKey = errors.New("unsupported jwk key")
+)
+
+const (
+	// jwksRefreshInterval is the minimal time between JWKS URL fetches
+	jwksRefreshInterval = 5 * time.Minute
+	jwksFetchTimeout    = 10 * time.Second
+	jwksMaxSize         = 1 << 20
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwks keeps public keys of an issuer loaded from a file or URL.
+type jwks struct {
+	file   string
+	url    string
+	client *http.Client
+
+	// refreshMu serializes refetches on unknown key ID
+	refreshMu sync.Mutex
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+	// fetched is the time of the last URL fetch, failed ones included,
+	// so unknown key IDs do not refetch an unavailable URL on every request
+	fetched time.Time
+}
+
+func newJWKS(file, url string) *jwks {
+	return &jwks{
+		file:   file,
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+// Reload reads keys from the file or URL. On error current keys are kept.
+func (s *jwks) Reload() error {
+	var buf []byte
+	var err error
+	if s.file != "" {
+		buf, err = os.ReadFile(s.file)
+	} else {
+		s.mu.Lock()
+		s.fetched = time.Now()
+		s.mu.Unlock()
+
+		buf, err = s.fetch(context.Background())
+	}
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(buf)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *jwks) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks %s: %s", s.url, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+}
+
+// key returns the key by its ID. Unknown key ID refetches the URL, as the issuer may rotate keys.
+func (s *jwks) key(kid string) (crypto.PublicKey, error) {
+	key, ok, stale := s.lookup(kid)
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		s.refreshMu.Lock()
+		// other request could refresh the keys while we waited
+		if key, ok, stale = s.lookup(kid); !ok && stale {
+			if err := s.Reload(); err != nil {
+				slog.Warn("JWKS refresh failed", "url", s.url, "error", err)
+			}
+			key, ok, _ = s.lookup(kid)
+		}
+		s.refreshMu.Unlock()
+
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+// lookup finds the key, empty kid is allowed if the set has only one key.
+// Stale is set if the keys could be refetched.
+func (s *jwks) lookup(kid string) (key crypto.PublicKey, ok, stale bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stale = s.url != "" && time.Since(s.fetched) > jwksRefreshInterval
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true, stale
+		}
+	}
+
+	key, ok = s.keys[kid]
+	return key, ok, stale
+}
+
+func parseJWKS(buf []byte) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if errors.Is(err, ErrUnsupportedJWKKey) {
+			slog.Debug("Skipping jwk", "kid", k.Kid, "error", err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("parse jwk %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedJWKKey, k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		// uncompressed point: 0x04 || X || Y, also checks that the point is on the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec key size")
+		}
+
+		return ecdsa.ParseUncompressedPublicKey(curve, slices.Concat([]byte{4}, x, y))
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedJWKKey, k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedJWKKey, k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(buf), nil
+}
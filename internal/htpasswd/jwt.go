@@ -0,0 +1,244 @@
+package htpasswd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownIssuer = errors.New("unknown jwt issuer")
+	ErrNoRuleMatched = errors.New("no rule matched jwt claims")
+)
+
+// jwtLeeway allows small clock skew with the issuer
+const jwtLeeway = time.Minute
+
+// jwtMethods are accepted signing algorithms, HMAC is not supported as keys are public.
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWTAuthenticator verifies bearer JWTs.
+type JWTAuthenticator interface {
+	AuthenticateJWT(token string) (id Identity, ok bool)
+}
+
+// JWTConfig is the JWT issuers file.
+type JWTConfig struct {
+	Issuers []JWTIssuer `json:"issuers"`
+}
+
+// JWTIssuer describes a trusted OIDC issuer, e.g. GitHub Actions or GitLab CI.
+type JWTIssuer struct {
+	// Issuer must match `iss` claim
+	Issuer string `json:"issuer"`
+	// Audience, one of them must be in `aud` claim
+	Audience []string `json:"audience"`
+	// JWKSURL or JWKSFile provides the signing keys
+	JWKSURL  string `json:"jwks_url,omitempty"`
+	JWKSFile string `json:"jwks_file,omitempty"`
+	// UserClaim is mapped to the user name, `sub` by default
+	UserClaim string `json:"user_claim,omitempty"`
+	// Rules are checked in order, the first matching rule grants its scopes.
+	// Token which does not match any rule is rejected.
+	Rules []JWTRule `json:"rules"`
+}
+
+// JWTRule grants scopes to tokens with matching claims.
+type JWTRule struct {
+	// Claims must all match, values are path.Match patterns, e.g. `refs/heads/*`
+	Claims map[string]string `json:"claims,omitempty"`
+	// User overrides the user claim
+	User   string `json:"user,omitempty"`
+	Scopes Scopes `json:"scopes,omitzero"`
+}
+
+type jwtIssuer struct {
+	JWTIssuer
+	keys *jwks
+}
+
+// JWTIssuers validates JWTs of configured issuers.
+type JWTIssuers struct {
+	issuers map[string]*jwtIssuer
+	now     func() time.Time
+}
+
+// NewJWTIssuersFromFile loads issuers config and their keys.
+func NewJWTIssuersFromFile(filename string) (*JWTIssuers, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg JWTConfig
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return nil, fmt.Errorf("parse jwt config: %w", err)
+	}
+
+	return NewJWTIssuers(cfg)
+}
+
+func NewJWTIssuers(cfg JWTConfig) (*JWTIssuers, error) {
+	ret := &JWTIssuers{
+		issuers: make(map[string]*jwtIssuer, len(cfg.Issuers)),
+		now:     time.Now,
+	}
+
+	for _, iss := range cfg.Issuers {
+		switch {
+		case iss.Issuer == "":
+			return nil, errors.New("jwt issuer: issuer is required")
+		case len(iss.Audience) == 0:
+			return nil, fmt.Errorf("jwt issuer %s: audience is required", iss.Issuer)
+		case (iss.JWKSURL == "") == (iss.JWKSFile == ""):
+			return nil, fmt.Errorf("jwt issuer %s: one of jwks_url or jwks_file is required", iss.Issuer)
+		case len(iss.Rules) == 0:
+			return nil, fmt.Errorf("jwt issuer %s: at least one rule is required", iss.Issuer)
+		}
+		if iss.UserClaim == "" {
+			iss.UserClaim = "sub"
+		}
+
+		ji := &jwtIssuer{JWTIssuer: iss, keys: newJWKS(iss.JWKSFile, iss.JWKSURL)}
+		if err := ji.keys.Reload(); err != nil {
+			// URL may be temporary unavailable, keys are fetched again on use
+			if iss.JWKSURL == "" {
+				return nil, fmt.Errorf("jwt issuer %s: %w", iss.Issuer, err)
+			}
+			slog.Warn("JWKS fetch failed", "issuer", iss.Issuer, "url", iss.JWKSURL, "error", err)
+		}
+
+		ret.issuers[iss.Issuer] = ji
+	}
+
+	return ret, nil
+}
+
+// IsJWT checks if the bearer credential looks like a JWT.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !IsToken(token)
+}
+
+// AuthenticateJWT implements JWTAuthenticator.
+func (s *JWTIssuers) AuthenticateJWT(token string) (Identity, bool) {
+	id, err := s.authenticate(token)
+	if err != nil {
+		slog.Warn("JWT rejected", "error", err)
+		return Identity{}, false
+	}
+
+	return id, true
+}
+
+func (s *JWTIssuers) authenticate(token string) (Identity, error) {
+	var unverified jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &unverified); err != nil {
+		return Identity{}, err
+	}
+
+	iss, ok := s.issuers[unverified.Issuer]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: %q", ErrUnknownIssuer, unverified.Issuer)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.NewParser(
+		jwt.WithValidMethods(jwtMethods),
+		// keep large numeric IDs, like repository_id, exact
+		jwt.WithJSONNumber(),
+		jwt.WithIssuer(iss.Issuer),
+		jwt.WithAudience(iss.Audience...),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+		jwt.WithTimeFunc(s.now),
+	).ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return iss.keys.key(kid)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	for _, rule := range iss.Rules {
+		if !rule.matches(claims) {
+			continue
+		}
+
+		user := rule.User
+		if user == "" {
+			user = claimString(claims, iss.UserClaim)
+		}
+		if user == "" {
+			return Identity{}, fmt.Errorf("claim %s is empty", iss.UserClaim)
+		}
+
+		return Identity{User: user, Issuer: iss.Issuer, Scopes: rule.Scopes}, nil
+	}
+
+	return Identity{}, fmt.Errorf("%w: iss %s sub %s", ErrNoRuleMatched, iss.Issuer, claimString(claims, "sub"))
+}
+
+// JWKSFiles returns sorted paths of the JWKS files.
+func (s *JWTIssuers) JWKSFiles() []string {
+	var ret []string
+	for _, iss := range s.issuers {
+		if iss.JWKSFile != "" {
+			ret = append(ret, iss.JWKSFile)
+		}
+	}
+
+	slices.Sort(ret)
+	return slices.Compact(ret)
+}
+
+// Reload reads JWKS files again. On error current keys are kept.
+func (s *JWTIssuers) Reload() error {
+	var errs []error
+	for _, iss := range s.issuers {
+		if iss.JWKSFile == "" {
+			continue
+		}
+		if err := iss.keys.Reload(); err != nil {
+			errs = append(errs, fmt.Errorf("jwt issuer %s: %w", iss.Issuer, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r JWTRule) matches(claims jwt.MapClaims) bool {
+	for name, pattern := range r.Claims {
+		ok, err := path.Match(pattern, claimString(claims, name))
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// claimString returns the claim as string, lists are joined by comma.
+func claimString(claims jwt.MapClaims, name string) string {
+	switch v := claims[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, p := range v {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,192 @@
+package htpasswd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJWKS(t *testing.T, kid string, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	// uncompressed point: 0x04 || X || Y
+	point, err := key.PublicKey.Bytes()
+	require.NoError(t, err)
+
+	buf, err := json.Marshal(jwkSet{Keys: []jwk{{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}}})
+	require.NoError(t, err)
+
+	return buf
+}
+
+func signTestJWT(t *testing.T, kid string, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	tok.Header["kid"] = kid
+	ret, err := tok.SignedString(key)
+	require.NoError(t, err)
+
+	return ret
+}
+
+func TestJWTIssuers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, testJWKS(t, "k1", key), 0600))
+
+	issuers, err := NewJWTIssuers(JWTConfig{Issuers: []JWTIssuer{{
+		Issuer:    "https://ci.example.com",
+		Audience:  []string{"zoneomatic"},
+		JWKSFile:  jwksFile,
+		UserClaim: "repository",
+		Rules: []JWTRule{
+			{
+				Claims: map[string]string{"repository": "infra/dns", "ref": "refs/heads/*"},
+				Scopes: Scopes{Endpoints: []string{EndpointZM}, Zones: []string{"example.com."}},
+			},
+			{
+				Claims: map[string]string{"repository_id": "1234567890"},
+				User:   "legacy",
+			},
+		},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{jwksFile}, issuers.JWKSFiles())
+
+	now := time.Now()
+	claims := func(override jwt.MapClaims) jwt.MapClaims {
+		ret := jwt.MapClaims{
+			"iss":        "https://ci.example.com",
+			"aud":        "zoneomatic",
+			"sub":        "repo:infra/dns:ref:refs/heads/main",
+			"repository": "infra/dns",
+			"ref":        "refs/heads/main",
+			"exp":        now.Add(5 * time.Minute).Unix(),
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(ret, k)
+			} else {
+				ret[k] = v
+			}
+		}
+		return ret
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		expected Identity
+		ok       bool
+	}{
+		{"ok", signTestJWT(t, "k1", key, claims(nil)), Identity{
+			User:   "infra/dns",
+			Issuer: "https://ci.example.com",
+			Scopes: Scopes{Endpoints: []string{EndpointZM}, Zones: []string{"example.com."}},
+		}, true},
+		{"second-rule", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"repository": "other/repo", "repository_id": 1234567890})),
+			Identity{User: "legacy", Issuer: "https://ci.example.com"}, true},
+		{"no-rule", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"ref": "refs/tags/v1"})), Identity{}, false},
+		{"expired", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})), Identity{}, false},
+		{"no-exp", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"exp": nil})), Identity{}, false},
+		{"wrong-aud", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"aud": "other"})), Identity{}, false},
+		{"unknown-iss", signTestJWT(t, "k1", key, claims(jwt.MapClaims{"iss": "https://evil.example.com"})), Identity{}, false},
+		{"wrong-key", signTestJWT(t, "k1", otherKey, claims(nil)), Identity{}, false},
+		{"unknown-kid", signTestJWT(t, "k2", key, claims(nil)), Identity{}, false},
+		{"garbage", "a.b.c", Identity{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, IsJWT(tc.token))
+
+			id, ok := issuers.AuthenticateJWT(tc.token)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, id)
+		})
+	}
+
+	// rotated key file is used after reload
+	require.NoError(t, os.WriteFile(jwksFile, testJWKS(t, "k2", otherKey), 0600))
+	require.NoError(t, issuers.Reload())
+	_, ok := issuers.AuthenticateJWT(signTestJWT(t, "k2", otherKey, claims(nil)))
+	assert.True(t, ok)
+}
+
+func TestJWTIssuers_JWKSURL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks := testJWKS(t, "k1", key)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer ts.Close()
+
+	issuers, err := NewJWTIssuers(JWTConfig{Issuers: []JWTIssuer{{
+		Issuer:   "https://ci.example.com",
+		Audience: []string{"zoneomatic"},
+		JWKSURL:  ts.URL,
+		Rules:    []JWTRule{{}},
+	}}})
+	require.NoError(t, err)
+
+	id, ok := issuers.AuthenticateJWT(signTestJWT(t, "k1", key, jwt.MapClaims{
+		"iss": "https://ci.example.com",
+		"aud": []string{"zoneomatic", "other"},
+		"sub": "runner",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}))
+	assert.True(t, ok)
+	assert.Equal(t, "runner", id.User)
+
+	_, err = NewJWTIssuers(JWTConfig{Issuers: []JWTIssuer{{Issuer: "https://ci.example.com", Audience: []string{"zoneomatic"}, JWKSURL: ts.URL}}})
+	assert.Error(t, err, "rules are required")
+}
+
+func TestJWKS_FailedFetchNotRepeated(t *testing.T) {
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	keys := newJWKS("", ts.URL)
+	for range 3 {
+		_, err := keys.key("unknown")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	}
+	assert.EqualValues(t, 1, fetches.Load())
+
+	// the next fetch is allowed after jwksRefreshInterval
+	keys.fetched = time.Now().Add(-jwksRefreshInterval - time.Second)
+	_, err := keys.key("unknown")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.EqualValues(t, 2, fetches.Load())
+}
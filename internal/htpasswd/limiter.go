@@ -0,0 +1,239 @@
+package htpasswd
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter key kinds, also used as blocked metric reason.
+const (
+	LimitByIP   = "ip"
+	LimitByUser = "user"
+)
+
+// LimiterConfig configures authentication failure limits.
+type LimiterConfig struct {
+	// Burst is the number of failures allowed before lockout.
+	Burst int
+	// Refill forgives one failure per period.
+	Refill time.Duration
+	// Lockout is the first lockout duration, doubled on each next lockout up to MaxLockout.
+	// Zero MaxLockout disables the backoff.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+// Limiter keeps token buckets of failed authentications per client IP and per user name.
+// When a bucket is empty, the key is locked out with exponential backoff.
+type Limiter struct {
+	cfg LimiterConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	tokens      float64
+	updated     time.Time
+	lockedUntil time.Time
+	lockouts    int
+}
+
+const limiterSweepInterval = time.Minute
+
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*limiterEntry),
+	}
+}
+
+// limiterKey is a bucket key, kind is one of LimitBy*.
+type limiterKey struct {
+	kind  string
+	value string
+}
+
+func (k limiterKey) String() string {
+	return k.kind + ":" + k.value
+}
+
+// keys returns the bucket keys for the client address and user.
+func (l *Limiter) keys(addr netip.Addr, user string) []limiterKey {
+	keys := make([]limiterKey, 0, 2)
+	if addr.IsValid() {
+		keys = append(keys, limiterKey{LimitByIP, ipKey(addr)})
+	}
+	if user != "" {
+		keys = append(keys, limiterKey{LimitByUser, user})
+	}
+
+	return keys
+}
+
+// blocked returns the kind of the locked out key and remaining lockout time.
+func (l *Limiter) blocked(keys ...limiterKey) (kind string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, k := range keys {
+		e, ok := l.entries[k.String()]
+		if !ok {
+			continue
+		}
+		if d := e.lockedUntil.Sub(now); d > retryAfter {
+			kind, retryAfter = k.kind, d
+		}
+	}
+
+	return
+}
+
+// failure takes a token from each key bucket and locks out keys with empty buckets.
+func (l *Limiter) failure(keys ...limiterKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	for _, k := range keys {
+		e, ok := l.entries[k.String()]
+		if !ok {
+			e = &limiterEntry{tokens: float64(l.cfg.Burst), updated: now}
+			l.entries[k.String()] = e
+		}
+
+		l.refill(e, now)
+		e.tokens--
+		if e.tokens >= 0 {
+			continue
+		}
+
+		e.tokens = 0
+		lockout := l.lockout(e.lockouts)
+		e.lockouts++
+		e.lockedUntil = now.Add(lockout)
+		// do not refill while locked out
+		e.updated = e.lockedUntil
+	}
+}
+
+// success forgets failures of the user name.
+// Client IP is not reset, so one valid account does not allow to guess others.
+func (l *Limiter) success(user string) {
+	if user == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, limiterKey{LimitByUser, user}.String())
+}
+
+// lockout returns the duration of the next lockout.
+func (l *Limiter) lockout(lockouts int) time.Duration {
+	maxLockout := l.cfg.MaxLockout
+	if maxLockout <= 0 {
+		maxLockout = l.cfg.Lockout
+	}
+
+	d := l.cfg.Lockout
+	for range lockouts {
+		if d >= maxLockout {
+			break
+		}
+		d *= 2
+	}
+
+	return min(d, maxLockout)
+}
+
+func (l *Limiter) refill(e *limiterEntry, now time.Time) {
+	if l.cfg.Refill <= 0 || !now.After(e.updated) {
+		return
+	}
+
+	e.tokens = min(float64(l.cfg.Burst), e.tokens+float64(now.Sub(e.updated))/float64(l.cfg.Refill))
+	e.updated = now
+}
+
+// sweep drops entries which are not locked out and got full buckets.
+// That also resets the backoff of the key.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for k, e := range l.entries {
+		l.refill(e, now)
+		if now.After(e.lockedUntil) && e.tokens >= float64(l.cfg.Burst) {
+			delete(l.entries, k)
+		}
+	}
+}
+
+// ClientIP returns the request client address.
+// X-Forwarded-For is used only if the peer is a trusted proxy,
+// then the right-most address which is not a trusted proxy is the client.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+
+	if !prefixesContain(addr, trustedProxies) {
+		return addr, true
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		fwd, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		addr = fwd.Unmap()
+		if !prefixesContain(addr, trustedProxies) {
+			break
+		}
+	}
+
+	return addr, true
+}
+
+func prefixesContain(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ipKey groups IPv6 clients by /64, as a single host usually owns the whole prefix.
+func ipKey(addr netip.Addr) string {
+	if addr.Is6() {
+		p, _ := addr.Prefix(64)
+		return p.String()
+	}
+
+	return addr.String()
+}
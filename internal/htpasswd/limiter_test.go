@@ -0,0 +1,97 @@
+package htpasswd
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLimiter(LimiterConfig{
+		Burst:      2,
+		Refill:     time.Minute,
+		Lockout:    time.Minute,
+		MaxLockout: 3 * time.Minute,
+	})
+	l.now = func() time.Time { return now }
+
+	ip := limiterKey{LimitByIP, "192.0.2.1"}
+	user := limiterKey{LimitByUser, "alice"}
+
+	l.failure(ip, user)
+	l.failure(ip, user)
+	_, retry := l.blocked(ip, user)
+	assert.Zero(t, retry, "burst is not exceeded yet")
+
+	l.failure(ip, user)
+	kind, retry := l.blocked(ip, user)
+	assert.Equal(t, LimitByIP, kind)
+	assert.Equal(t, time.Minute, retry)
+
+	// success resets user, but not ip
+	l.success("alice")
+	_, retry = l.blocked(user)
+	assert.Zero(t, retry)
+	_, retry = l.blocked(ip)
+	assert.Equal(t, time.Minute, retry)
+
+	// next failure after the lockout doubles it, up to the max
+	now = now.Add(time.Minute)
+	l.failure(ip)
+	_, retry = l.blocked(ip)
+	assert.Equal(t, 2*time.Minute, retry)
+
+	now = now.Add(2 * time.Minute)
+	l.failure(ip)
+	_, retry = l.blocked(ip)
+	assert.Equal(t, 3*time.Minute, retry)
+
+	// refilled bucket allows burst again
+	now = now.Add(3*time.Minute + 2*time.Minute)
+	l.failure(ip)
+	_, retry = l.blocked(ip)
+	assert.Zero(t, retry)
+
+	// quiet key is swept, so backoff is reset
+	now = now.Add(time.Hour)
+	l.failure(user)
+	assert.NotContains(t, l.entries, ip.String())
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"untrusted-forwarded", "192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"trusted-forwarded", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed-chain", "10.0.0.1:1234", "203.0.113.1, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"trusted-no-header", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"v4-mapped", "[::ffff:192.0.2.1]:1234", "", "192.0.2.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+
+			addr, ok := ClientIP(r, trusted)
+			assert.True(t, ok)
+			assert.Equal(t, tc.expected, addr.String())
+		})
+	}
+
+	assert.Equal(t, "2001:db8:1:2::/64", ipKey(netip.MustParseAddr("2001:db8:1:2:3::4")))
+}
@@ -2,44 +2,244 @@ package htpasswd
 
 import (
 	"encoding/base64"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-fuego/fuego"
+
+	"github.com/vooon/zoneomatic/internal/stats"
 )
 
-func NewBasicAuthMiddleware(ht HTPasswd) func(http.Handler) http.Handler {
+// MiddlewareOption configures auth middlewares.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	tokens    TokenAuthenticator
+	jwts      JWTAuthenticator
+	limiter   *Limiter
+	certField string
+	policies  UserPolicies
+
+	trustedProxies []netip.Prefix
+}
+
+// WithTokens also accepts API tokens as `Authorization: Bearer`, X-API-Key or Basic auth password.
+func WithTokens(ta TokenAuthenticator) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.tokens = ta
+	}
+}
+
+// WithJWT also accepts JWTs of trusted issuers as `Authorization: Bearer`.
+func WithJWT(ja JWTAuthenticator) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.jwts = ja
+	}
+}
+
+// WithLimiter rejects clients with too many failed attempts with 429 Too Many Requests.
+func WithLimiter(l *Limiter) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.limiter = l
+	}
+}
+
+// WithPolicies applies per-user restrictions.
+func WithPolicies(p UserPolicies) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.policies = p
+	}
+}
+
+// WithTrustedProxies allows the proxies to set the client address by X-Forwarded-For.
+func WithTrustedProxies(prefixes []netip.Prefix) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.trustedProxies = prefixes
+	}
+}
+
+func newMiddlewareConfig(opts []MiddlewareOption) *middlewareConfig {
+	cfg := &middlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// credentials are extracted from the request by a middleware.
+type credentials struct {
+	user string
+	// secret is a password or token secret
+	secret string
+	// bearer secret is always a token or JWT
+	bearer bool
+}
+
+// limitUser returns the user name to limit failures by. Tokens are not guessable, so only IP is limited.
+func (c credentials) limitUser() string {
+	if c.bearer || IsToken(c.secret) {
+		return ""
+	}
+
+	return c.user
+}
+
+// authenticate checks user password, or token if password is a token secret.
+func (c *middlewareConfig) authenticate(ht HTPasswd, cred credentials) (Identity, bool) {
+	if cred.bearer && IsJWT(cred.secret) {
+		if c.jwts == nil {
+			return Identity{}, false
+		}
+		return c.jwts.AuthenticateJWT(cred.secret)
+	}
+
+	if cred.bearer || (c.tokens != nil && IsToken(cred.secret)) {
+		if c.tokens == nil {
+			return Identity{}, false
+		}
+
+		id, ok := c.tokens.AuthenticateToken(cred.secret)
+		if ok && !ht.HasUser(id.User) {
+			// tokens act for their owner, so they stop working with the owner removed
+			slog.Warn("Token owner not found", "token_id", id.Token, "owner", id.User)
+			return Identity{}, false
+		}
+		return id, ok
+	}
+
+	if ok, _ := ht.Authenticate(cred.user, cred.secret); ok {
+		return Identity{User: cred.user}, true
+	}
+
+	return Identity{}, false
+}
+
+// bearerCredentials returns `Authorization: Bearer` token, if present.
+func bearerCredentials(r *http.Request) (credentials, bool) {
+	secret, present := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !present {
+		return credentials{}, false
+	}
+
+	return credentials{secret: strings.TrimSpace(secret), bearer: true}, true
+}
+
+// serve authenticates credentials and calls next handler or onUnauthorized.
+func (c *middlewareConfig) serve(w http.ResponseWriter, r *http.Request, next http.Handler, ht HTPasswd,
+	cred credentials, present bool, onUnauthorized func(http.ResponseWriter, *http.Request)) {
+
+	addr, _ := ClientIP(r, c.trustedProxies)
+
+	var keys []limiterKey
+	if c.limiter != nil {
+		keys = c.limiter.keys(addr, cred.limitUser())
+		if kind, retryAfter := c.limiter.blocked(keys...); retryAfter > 0 {
+			stats.Default.RecordAuthBlocked(r.Context(), kind)
+			slog.WarnContext(r.Context(), "Authentication locked out", "by", kind, "user", cred.limitUser(),
+				"remote_addr", r.RemoteAddr, "retry_after", retryAfter)
+			sendTooManyRequests(w, retryAfter)
+			return
+		}
+	}
+
+	var id Identity
+	ok := false
+	if present {
+		id, ok = c.authenticate(ht, cred)
+	} else if user, certOk := clientCertUser(r, c.certField); certOk {
+		// explicit credentials take precedence over the client certificate
+		id, ok = Identity{User: user}, true
+	}
+
+	if ok && !c.allowsSource(id, addr) {
+		// do not tell that the password is right
+		slog.WarnContext(r.Context(), "Client address is not allowed", "user", id.User, "token_id", id.Token,
+			"client_ip", addr)
+		ok = false
+	}
+
+	if ok {
+		if c.limiter != nil {
+			c.limiter.success(cred.limitUser())
+		}
+
+		id.ClientIP = addr
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+		return
+	}
+
+	stats.Default.RecordAuthFailure(r.Context())
+	// missing credentials are usual for the first request, do not count them
+	if c.limiter != nil && present {
+		c.limiter.failure(keys...)
+	}
+
+	onUnauthorized(w, r)
+}
+
+// allowsSource checks identity scopes and the user policy.
+// Tokens are also limited by their owner policy, JWT users are not htpasswd users.
+func (c *middlewareConfig) allowsSource(id Identity, addr netip.Addr) bool {
+	if !id.Scopes.AllowsSource(addr) {
+		return false
+	}
+
+	if c.policies != nil && id.Issuer == "" {
+		return c.policies.UserPolicy(id.User).AllowsSource(addr)
+	}
+
+	return true
+}
+
+func sendTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	err := fuego.HTTPError{
+		Title:  "too many requests",
+		Detail: "too many failed authentication attempts",
+		Status: http.StatusTooManyRequests,
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	fuego.SendJSONError(w, nil, err)
+}
+
+func NewBasicAuthMiddleware(ht HTPasswd, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+
+	onUnauthorized := func(w http.ResponseWriter, _ *http.Request) {
+		err := fuego.HTTPError{
+			Title:  "unauthorized access",
+			Detail: "wrong username or password",
+			Status: http.StatusUnauthorized,
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		fuego.SendJSONError(w, nil, err)
+	}
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-			user, password, ok := r.BasicAuth()
+			cred, ok := bearerCredentials(r)
 			if !ok {
-				// Fallback to DNS-API headers
-				user = r.Header.Get("X-Api-User")
-				password = r.Header.Get("X-Api-Key")
-				ok = len(user) > 0 && len(password) > 0
-			}
-			if ok {
-				ok, _ = ht.Authenticate(user, password)
-			}
-			if ok {
-				h.ServeHTTP(w, r)
-				return
+				cred.user, cred.secret, ok = r.BasicAuth()
+				if !ok {
+					// Fallback to DNS-API headers
+					cred.user = r.Header.Get("X-Api-User")
+					cred.secret = r.Header.Get("X-Api-Key")
+					ok = (len(cred.user) > 0 || IsToken(cred.secret)) && len(cred.secret) > 0
+				}
 			}
 
-			err := fuego.HTTPError{
-				Title:  "unauthorized access",
-				Detail: "wrong username or password",
-				Status: http.StatusUnauthorized,
-			}
-
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			fuego.SendJSONError(w, nil, err)
+			cfg.serve(w, r, h, ht, cred, ok, onUnauthorized)
 		})
 	}
 }
 
-func NewAPIKeyMiddleware(ht HTPasswd) func(http.Handler) http.Handler {
+func NewAPIKeyMiddleware(ht HTPasswd, opts ...MiddlewareOption) func(http.Handler) http.Handler {
 	return NewAPIKeyMiddlewareWithUnauthorized(ht, func(w http.ResponseWriter, _ *http.Request) {
 		err := fuego.HTTPError{
 			Title:  "unauthorized access",
@@ -48,49 +248,62 @@ func NewAPIKeyMiddleware(ht HTPasswd) func(http.Handler) http.Handler {
 		}
 
 		fuego.SendJSONError(w, nil, err)
-	})
+	}, opts...)
 }
 
-func NewAPIKeyMiddlewareWithUnauthorized(ht HTPasswd, onUnauthorized func(http.ResponseWriter, *http.Request)) func(http.Handler) http.Handler {
+func NewAPIKeyMiddlewareWithUnauthorized(ht HTPasswd, onUnauthorized func(http.ResponseWriter, *http.Request), opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user, password, ok := r.BasicAuth()
-			if ok {
-				ok, _ = ht.Authenticate(user, password)
-			} else {
-				ok = AuthenticateAPIKeyHeader(ht, r.Header.Get("X-API-Key"))
-			}
-
-			if ok {
-				h.ServeHTTP(w, r)
-				return
+			cred, ok := bearerCredentials(r)
+			if !ok {
+				cred.user, cred.secret, ok = r.BasicAuth()
+				if !ok {
+					apiKey := strings.TrimSpace(r.Header.Get("X-API-Key"))
+					if cfg.tokens != nil && IsToken(apiKey) {
+						cred.secret, ok = apiKey, true
+					} else {
+						cred.user, cred.secret, ok = apiKeyCredentials(apiKey)
+					}
+				}
 			}
 
-			onUnauthorized(w, r)
+			cfg.serve(w, r, h, ht, cred, ok, onUnauthorized)
 		})
 	}
 }
 
 func AuthenticateAPIKeyHeader(ht HTPasswd, headerValue string) bool {
+	user, password, ok := apiKeyCredentials(headerValue)
+	if !ok {
+		return false
+	}
+
+	ok, _ = ht.Authenticate(user, password)
+	return ok
+}
+
+// apiKeyCredentials decodes base64 `user:password` of the PDNS X-API-Key.
+func apiKeyCredentials(headerValue string) (user, password string, ok bool) {
 	headerValue = strings.TrimSpace(headerValue)
 	if headerValue == "" {
-		return false
+		return "", "", false
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(headerValue)
 	if err != nil {
-		return false
+		return "", "", false
 	}
 
 	// Be tolerant of credentials generated via `echo user:pass | base64`,
 	// which encode a trailing newline into the decoded payload.
 	creds := strings.TrimRight(string(decoded), "\r\n")
 
-	user, password, ok := strings.Cut(creds, ":")
+	user, password, ok = strings.Cut(creds, ":")
 	if !ok || user == "" {
-		return false
+		return "", "", false
 	}
 
-	ok, _ = ht.Authenticate(user, password)
-	return ok
+	return user, password, true
 }
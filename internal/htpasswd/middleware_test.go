@@ -2,10 +2,16 @@ package htpasswd
 
 import (
 	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthenticateAPIKeyHeader(t *testing.T) {
@@ -36,3 +42,34 @@ func TestAuthenticateAPIKeyHeader(t *testing.T) {
 		assert.False(t, AuthenticateAPIKeyHeader(ht, key))
 	})
 }
+
+func TestBasicAuthMiddleware_TokenOwnerRemoved(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, []byte("alice:"+string(hash)+"\nbob:"+string(hash)+"\n"), 0600))
+
+	ht, err := NewFromFile(filename)
+	require.NoError(t, err)
+	tokens, err := NewTokensFromFile(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	secret, _, err := tokens.Create("router", "alice", time.Time{}, Scopes{})
+	require.NoError(t, err)
+
+	h := NewBasicAuthMiddleware(ht, WithTokens(tokens))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, do())
+
+	require.NoError(t, ht.DeleteUser("alice"))
+	assert.Equal(t, http.StatusUnauthorized, do())
+}
@@ -0,0 +1,97 @@
+package htpasswd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+)
+
+// RoleAdmin allows user management.
+const RoleAdmin = "admin"
+
+// UserPolicies provides per-user restrictions.
+type UserPolicies interface {
+	UserPolicy(user string) UserPolicy
+}
+
+// UserPolicy restricts a user, applies to its password, client certificate and owned tokens.
+type UserPolicy struct {
+	// Sources is a list of allowed client networks, empty allows any
+	Sources []netip.Prefix `json:"sources,omitempty"`
+	// Roles grant additional rights, e.g. RoleAdmin
+	Roles []string `json:"roles,omitempty"`
+}
+
+type policyFileData struct {
+	Users map[string]UserPolicy `json:"users"`
+}
+
+// PolicyFile keeps user policies in a JSON file.
+type PolicyFile struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]UserPolicy
+}
+
+// NewPolicyFromFile loads user policies.
+func NewPolicyFromFile(filename string) (*PolicyFile, error) {
+	users, err := parsePolicyFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PolicyFile{path: filename, users: users}, nil
+}
+
+func parsePolicyFile(filename string) (map[string]UserPolicy, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var data policyFileData
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+
+	return data.Users, nil
+}
+
+// Reload reads the file again. On error current policies are kept.
+func (s *PolicyFile) Reload() error {
+	users, err := parsePolicyFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+
+	slog.Info("User policy reloaded", "file", s.path, "users", slices.Sorted(maps.Keys(users)))
+	return nil
+}
+
+// UserPolicy implements UserPolicies. Unknown user has no restrictions.
+func (s *PolicyFile) UserPolicy(user string) UserPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.users[user]
+}
+
+// AllowsSource checks if the client address is allowed.
+func (p UserPolicy) AllowsSource(addr netip.Addr) bool {
+	return allowsSource(p.Sources, addr)
+}
+
+// HasRole checks if the user has the role.
+func (p UserPolicy) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
@@ -0,0 +1,36 @@
+package htpasswd
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{"users": {"router": {"sources": ["192.0.2.0/24", "2001:db8::/32"]}}}`), 0600))
+
+	policies, err := NewPolicyFromFile(filename)
+	require.NoError(t, err)
+
+	router := policies.UserPolicy("router")
+	assert.True(t, router.AllowsSource(netip.MustParseAddr("192.0.2.10")))
+	assert.True(t, router.AllowsSource(netip.MustParseAddr("::ffff:192.0.2.10")))
+	assert.True(t, router.AllowsSource(netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, router.AllowsSource(netip.MustParseAddr("198.51.100.1")))
+	assert.False(t, router.AllowsSource(netip.Addr{}))
+	assert.True(t, policies.UserPolicy("other").AllowsSource(netip.MustParseAddr("198.51.100.1")))
+
+	// broken file keeps previous policy
+	require.NoError(t, os.WriteFile(filename, []byte(`{"users": {"router": {"sources": ["bad"]}}}`), 0600))
+	assert.Error(t, policies.Reload())
+	assert.False(t, policies.UserPolicy("router").AllowsSource(netip.MustParseAddr("198.51.100.1")))
+
+	require.NoError(t, os.WriteFile(filename, []byte(`{"users": {}}`), 0600))
+	require.NoError(t, policies.Reload())
+	assert.True(t, policies.UserPolicy("router").AllowsSource(netip.MustParseAddr("198.51.100.1")))
+}
@@ -0,0 +1,239 @@
+package htpasswd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+// TokenPrefix starts every token secret, so it can be told apart from a password.
+const TokenPrefix = "zmt_"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExists   = errors.New("token already exists")
+)
+
+// TokenAuthenticator verifies API token secrets.
+type TokenAuthenticator interface {
+	AuthenticateToken(secret string) (id Identity, ok bool)
+}
+
+// Token is a stored API token. The secret itself is never stored, only its SHA-256.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Owner   string    `json:"owner"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitzero"`
+	Scopes  Scopes    `json:"scopes,omitzero"`
+}
+
+// Expired checks token expiry. Zero Expires never expires.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+type tokenFileData struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// TokenFile keeps API tokens in a JSON file.
+type TokenFile struct {
+	path   string
+	mu     sync.RWMutex
+	tokens []Token
+}
+
+// NewTokensFromFile loads tokens. A missing file means no tokens.
+func NewTokensFromFile(filename string) (*TokenFile, error) {
+	tokens, err := parseTokensFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenFile{path: filename, tokens: tokens}, nil
+}
+
+func parseTokensFile(filename string) ([]Token, error) {
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var data tokenFileData
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return nil, fmt.Errorf("parse tokens file: %w", err)
+	}
+
+	return data.Tokens, nil
+}
+
+// Reload reads the file again. On error current tokens are kept.
+func (s *TokenFile) Reload() error {
+	tokens, err := parseTokensFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	tokenMap := func(tokens []Token) map[string]string {
+		ret := make(map[string]string, len(tokens))
+		for _, t := range tokens {
+			ret[t.Name+" ("+t.ID+")"] = t.Hash
+		}
+		return ret
+	}
+
+	s.mu.Lock()
+	added, removed, _ := diffKeys(tokenMap(s.tokens), tokenMap(tokens))
+	s.tokens = tokens
+	s.mu.Unlock()
+
+	slog.Info("API tokens reloaded", "file", s.path, "tokens", len(tokens), "added", added, "removed", removed)
+	return nil
+}
+
+// AuthenticateToken implements TokenAuthenticator.
+func (s *TokenFile) AuthenticateToken(secret string) (id Identity, ok bool) {
+	tokenID, ok := parseTokenID(secret)
+	if !ok {
+		return Identity{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := slices.IndexFunc(s.tokens, func(t Token) bool { return t.ID == tokenID })
+	if idx < 0 {
+		return Identity{}, false
+	}
+
+	t := s.tokens[idx]
+	if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashTokenSecret(secret))) != 1 {
+		return Identity{}, false
+	}
+
+	if t.Expired(time.Now()) {
+		slog.Warn("Expired token used", "token_id", t.ID, "token_name", t.Name, "owner", t.Owner)
+		return Identity{}, false
+	}
+
+	return Identity{User: t.Owner, Token: t.ID, Scopes: t.Scopes}, true
+}
+
+// List returns all tokens.
+func (s *TokenFile) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.tokens)
+}
+
+// Create generates a new token and saves the file.
+// The returned secret is shown once and cannot be recovered later.
+func (s *TokenFile) Create(name, owner string, expires time.Time, scopes Scopes) (secret string, token Token, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.tokens, func(t Token) bool { return t.Name == name }) {
+		return "", Token{}, fmt.Errorf("%w: %s", ErrTokenExists, name)
+	}
+
+	idBuf := make([]byte, 8)
+	secretBuf := make([]byte, 32)
+	_, _ = rand.Read(idBuf)
+	_, _ = rand.Read(secretBuf)
+
+	token = Token{
+		ID:      hex.EncodeToString(idBuf),
+		Name:    name,
+		Owner:   owner,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Expires: expires,
+		Scopes:  scopes,
+	}
+	secret = TokenPrefix + token.ID + "_" + base64.RawURLEncoding.EncodeToString(secretBuf)
+	token.Hash = hashTokenSecret(secret)
+
+	tokens := append(slices.Clone(s.tokens), token)
+	if err := s.save(tokens); err != nil {
+		return "", Token{}, err
+	}
+
+	s.tokens = tokens
+	return secret, token, nil
+}
+
+// Revoke removes a token by its ID or name and saves the file.
+func (s *TokenFile) Revoke(idOrName string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := slices.IndexFunc(s.tokens, func(t Token) bool { return t.ID == idOrName || t.Name == idOrName })
+	if idx < 0 {
+		return Token{}, fmt.Errorf("%w: %s", ErrTokenNotFound, idOrName)
+	}
+
+	token := s.tokens[idx]
+	tokens := slices.Delete(slices.Clone(s.tokens), idx, idx+1)
+	if err := s.save(tokens); err != nil {
+		return Token{}, err
+	}
+
+	s.tokens = tokens
+	return token, nil
+}
+
+func (s *TokenFile) save(tokens []Token) error {
+	buf, err := json.MarshalIndent(tokenFileData{Tokens: tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Create the file beforehand, so AtomicWriteFile keeps private permissions.
+	fd, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_ = fd.Close()
+	} else if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	return fileutil.AtomicWriteFile(s.path, append(buf, '\n'))
+}
+
+// IsToken checks if the credential looks like a token secret.
+func IsToken(secret string) bool {
+	return strings.HasPrefix(secret, TokenPrefix)
+}
+
+func parseTokenID(secret string) (string, bool) {
+	rest, ok := strings.CutPrefix(secret, TokenPrefix)
+	if !ok {
+		return "", false
+	}
+
+	id, _, ok := strings.Cut(rest, "_")
+	return id, ok && id != ""
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tokens.json")
+
+	tokens, err := NewTokensFromFile(filename)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.List())
+
+	secret, token, err := tokens.Create("router", "test", time.Time{}, Scopes{Endpoints: []string{EndpointDDNS}})
+	require.NoError(t, err)
+	assert.True(t, IsToken(secret))
+
+	_, _, err = tokens.Create("router", "test", time.Time{}, Scopes{})
+	assert.ErrorIs(t, err, ErrTokenExists)
+
+	expiredSecret, _, err := tokens.Create("expired", "test", time.Now().Add(-time.Minute), Scopes{})
+	require.NoError(t, err)
+
+	st, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	buf, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), secret)
+
+	// reload from disk
+	tokens, err = NewTokensFromFile(filename)
+	require.NoError(t, err)
+	assert.Len(t, tokens.List(), 2)
+
+	id, ok := tokens.AuthenticateToken(secret)
+	assert.True(t, ok)
+	assert.Equal(t, Identity{User: "test", Token: token.ID, Scopes: Scopes{Endpoints: []string{EndpointDDNS}}}, id)
+
+	_, ok = tokens.AuthenticateToken(secret + "x")
+	assert.False(t, ok)
+	_, ok = tokens.AuthenticateToken(expiredSecret)
+	assert.False(t, ok)
+
+	_, err = tokens.Revoke("router")
+	require.NoError(t, err)
+	_, ok = tokens.AuthenticateToken(secret)
+	assert.False(t, ok)
+
+	_, err = tokens.Revoke("router")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestScopes(t *testing.T) {
+	s := Scopes{
+		Endpoints: []string{EndpointACME},
+		Zones:     []string{"lab.example.com."},
+		Names:     []string{"home.example.org", "*.dyn.example.net."},
+	}
+
+	assert.True(t, s.AllowsEndpoint(EndpointACME))
+	assert.False(t, s.AllowsEndpoint(EndpointPDNS))
+	assert.False(t, Scopes{}.AllowsEndpoint(EndpointAdmin))
+	assert.True(t, Scopes{}.AllowsEndpoint(EndpointPDNS))
+
+	assert.True(t, s.AllowsName("lab.example.com."))
+	assert.True(t, s.AllowsName("x.LAB.example.com"))
+	assert.True(t, s.AllowsName("home.example.org."))
+	assert.False(t, s.AllowsName("www.home.example.org."))
+	assert.True(t, s.AllowsName("a.dyn.example.net."))
+	assert.False(t, s.AllowsName("dyn.example.net."))
+	assert.False(t, s.AllowsName("example.com."))
+
+	assert.True(t, s.AllowsZone("example.org."))
+	assert.True(t, s.AllowsZone("lab.example.com."))
+	assert.True(t, s.AllowsZone("example.net."))
+	assert.False(t, s.AllowsZone("example.com."))
+
+	assert.True(t, Scopes{}.AllowsName("anything."))
+}
+
+func TestTokenFile_Reload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tokens.json")
+
+	tokens, err := NewTokensFromFile(filename)
+	require.NoError(t, err)
+
+	// another process (token command) adds a token
+	other, err := NewTokensFromFile(filename)
+	require.NoError(t, err)
+	secret, _, err := other.Create("router", "test", time.Time{}, Scopes{})
+	require.NoError(t, err)
+
+	_, ok := tokens.AuthenticateToken(secret)
+	assert.False(t, ok)
+
+	require.NoError(t, tokens.Reload())
+	id, ok := tokens.AuthenticateToken(secret)
+	assert.True(t, ok)
+	assert.Equal(t, "test", id.User)
+
+	// broken file keeps previous tokens
+	require.NoError(t, os.WriteFile(filename, []byte("{broken"), 0600))
+	assert.Error(t, tokens.Reload())
+	_, ok = tokens.AuthenticateToken(secret)
+	assert.True(t, ok)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-fuego/fuego"
+	"github.com/go-fuego/fuego/option"
+	"github.com/go-fuego/fuego/param"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vooon/zoneomatic/internal/audit"
+	"github.com/vooon/zoneomatic/internal/htpasswd"
+)
+
+type AdminUser struct {
+	User string `json:"user"`
+}
+
+type AdminUserCreateRequest struct {
+	User string `json:"user" validate:"required"`
+	// Password is generated if empty
+	Password string `json:"password,omitempty"`
+}
+
+type AdminPasswordRequest struct {
+	// Password is generated if empty
+	Password string `json:"password,omitempty"`
+}
+
+type AdminUserResponse struct {
+	User string `json:"user"`
+	// Password is returned only if it was generated
+	Password string `json:"password,omitempty"`
+}
+
+// generatedPasswordBytes gives 32 characters in base64
+const generatedPasswordBytes = 24
+
+// maxAuditLimit bounds the number of returned audit entries
+const maxAuditLimit = 1000
+
+// newAdminMiddleware allows only users with the admin role.
+// Tokens also need the admin endpoint in their scopes, JWT identities are never admins.
+func newAdminMiddleware(policies htpasswd.UserPolicies) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := htpasswd.IdentityFromContext(r.Context())
+
+			switch {
+			case id.Issuer != "":
+				sendForbidden(w, r, "jwt identities can not manage users")
+			case id.Token != "" && !id.Scopes.AllowsEndpoint(htpasswd.EndpointAdmin):
+				sendForbidden(w, r, "token is not allowed to use admin endpoints")
+			case policies == nil || !policies.UserPolicy(id.User).HasRole(htpasswd.RoleAdmin):
+				sendForbidden(w, r, "admin role required")
+			default:
+				h.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func registerAdminEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, cfg *endpointsConfig) {
+	if cfg.users == nil {
+		return
+	}
+
+	users := cfg.users
+	authMw := htpasswd.NewBasicAuthMiddleware(htp, cfg.authOpts...)
+	adminMw := newAdminMiddleware(cfg.policies)
+	security := option.Security(openapi3.SecurityRequirement{"basicAuth": []string{}})
+
+	fuego.Get(srv, "/admin/users",
+		func(ctx fuego.ContextNoBody) ([]AdminUser, error) {
+			ret := make([]AdminUser, 0)
+			for _, u := range users.Users() {
+				ret = append(ret, AdminUser{User: u})
+			}
+
+			return ret, nil
+		},
+		option.Summary("list users"),
+		option.Description("List htpasswd users"),
+		option.Middleware(authMw, adminMw),
+		security,
+	)
+
+	fuego.Post(srv, "/admin/users",
+		func(ctx fuego.ContextWithBody[AdminUserCreateRequest]) (*AdminUserResponse, error) {
+			req, err := ctx.Body()
+			if err != nil {
+				return nil, err
+			}
+
+			password, generated := passwordOrGenerate(req.Password)
+			if err := users.AddUser(req.User, password); err != nil {
+				return nil, userErrorToHTTPError(err)
+			}
+
+			slog.InfoContext(ctx, "User created", "user", req.User, "by", adminName(ctx))
+			return userResponse(req.User, password, generated), nil
+		},
+		option.Summary("create user"),
+		option.Description("Create htpasswd user with the supplied or generated password"),
+		option.Middleware(authMw, adminMw),
+		security,
+		option.DefaultStatusCode(http.StatusCreated),
+		option.AddResponse(http.StatusForbidden, "Admin role required", fuego.Response{Type: new(fuego.HTTPError)}),
+		option.AddResponse(http.StatusConflict, "User already exists", fuego.Response{Type: new(fuego.HTTPError)}),
+	)
+
+	fuego.Put(srv, "/admin/users/{user}/password",
+		func(ctx fuego.ContextWithBody[AdminPasswordRequest]) (*AdminUserResponse, error) {
+			user := ctx.PathParam("user")
+			req, err := ctx.Body()
+			if err != nil {
+				return nil, err
+			}
+
+			password, generated := passwordOrGenerate(req.Password)
+			if err := users.SetPassword(user, password); err != nil {
+				return nil, userErrorToHTTPError(err)
+			}
+
+			slog.InfoContext(ctx, "User password changed", "user", user, "by", adminName(ctx))
+			return userResponse(user, password, generated), nil
+		},
+		option.Summary("change password"),
+		option.Description("Set the supplied or generated password of htpasswd user"),
+		option.Middleware(authMw, adminMw),
+		security,
+		option.AddResponse(http.StatusNotFound, "User not found", fuego.Response{Type: new(fuego.HTTPError)}),
+	)
+
+	fuego.DeleteStd(srv, "/admin/users/{user}",
+		func(w http.ResponseWriter, r *http.Request) {
+			user := r.PathValue("user")
+			if err := users.DeleteUser(user); err != nil {
+				fuego.SendError(w, r, userErrorToHTTPError(err))
+				return
+			}
+
+			slog.InfoContext(r.Context(), "User deleted", "user", user, "by", adminName(r.Context()))
+			w.WriteHeader(http.StatusNoContent)
+		},
+		option.Summary("delete user"),
+		option.Description("Delete htpasswd user, API tokens of the user stop working"),
+		option.Middleware(authMw, adminMw),
+		security,
+		option.DefaultStatusCode(http.StatusNoContent),
+		option.AddResponse(http.StatusNotFound, "User not found", fuego.Response{Type: new(fuego.HTTPError)}),
+	)
+}
+
+func registerAuditEndpoint(srv *fuego.Server, htp htpasswd.HTPasswd, cfg *endpointsConfig) {
+	if cfg.audit == nil {
+		return
+	}
+
+	auditLog := cfg.audit
+	authMw := htpasswd.NewBasicAuthMiddleware(htp, cfg.authOpts...)
+	adminMw := newAdminMiddleware(cfg.policies)
+
+	fuego.Get(srv, "/admin/audit",
+		func(ctx fuego.ContextNoBody) ([]audit.Entry, error) {
+			name := strings.TrimSpace(ctx.QueryParam("name"))
+			if name == "" {
+				return nil, badRequestError("missing required query parameter: name")
+			}
+
+			limit := 1
+			if ctx.QueryParam("limit") != "" {
+				var err error
+				limit, err = ctx.QueryParamIntErr("limit")
+				if err != nil || limit < 1 || limit > maxAuditLimit {
+					return nil, badRequestError("limit must be a number from 1 to 1000")
+				}
+			}
+
+			return auditLog.Find(name, ctx.QueryParam("type"), limit)
+		},
+		option.Summary("audit log"),
+		option.Description("Return last changes of the record name, newest first"),
+		option.Middleware(authMw, adminMw),
+		option.Security(openapi3.SecurityRequirement{"basicAuth": []string{}}),
+		option.Query("name", "Fully-qualified record name", param.Required()),
+		option.Query("type", "Record type; any type if empty"),
+		option.QueryInt("limit", "Number of entries to return, 1 by default"),
+		option.AddResponse(http.StatusForbidden, "Admin role required", fuego.Response{Type: new(fuego.HTTPError)}),
+	)
+}
+
+func passwordOrGenerate(password string) (string, bool) {
+	if password != "" {
+		return password, false
+	}
+
+	buf := make([]byte, generatedPasswordBytes)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf), true
+}
+
+func userResponse(user, password string, generated bool) *AdminUserResponse {
+	ret := &AdminUserResponse{User: user}
+	if generated {
+		ret.Password = password
+	}
+
+	return ret
+}
+
+func adminName(ctx context.Context) string {
+	id, _ := htpasswd.IdentityFromContext(ctx)
+	return id.User
+}
+
+func userErrorToHTTPError(err error) error {
+	switch {
+	case errors.Is(err, htpasswd.ErrUserNotFound):
+		return &fuego.HTTPError{Title: "user not found", Detail: err.Error(), Status: http.StatusNotFound}
+	case errors.Is(err, htpasswd.ErrUserExists):
+		return &fuego.HTTPError{Title: "user already exists", Detail: err.Error(), Status: http.StatusConflict}
+	case errors.Is(err, htpasswd.ErrInvalidUser), errors.Is(err, bcrypt.ErrPasswordTooLong):
+		return badRequestError(err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vooon/zoneomatic/internal/zone"
+)
+
+// configZonesKey is the config section with per-zone settings, other keys are flags
+const configZonesKey = "zones"
+
+// Config is the configuration file.
+//
+// Global settings use flag names, either flat (`otel-endpoint: ...`) or nested by prefix
+// (`otel: {endpoint: ...}`). Flags and environment variables override the file.
+type Config struct {
+	Zones []ZoneConfig `yaml:"zones"`
+
+	// global holds flag values
+	global map[string]any
+}
+
+// ZoneConfig is per-zone settings, see zone.FileConfig.
+type ZoneConfig struct {
+	// File is relative to the config file directory
+	File         string       `yaml:"file"`
+	AcmeTTL      *int         `yaml:"acme_ttl"`
+	DefaultTTL   int          `yaml:"default_ttl"`
+	SerialPolicy string       `yaml:"serial_policy"`
+	Operations   []string     `yaml:"operations"`
+	Hooks        []HookConfig `yaml:"hooks"`
+	Notify       []string     `yaml:"notify"`
+}
+
+type HookConfig struct {
+	Command []string      `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LoadConfig reads and validates the configuration file.
+func LoadConfig(filename string) (*Config, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseConfig(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	dir := filepath.Dir(filename)
+	for i := range cfg.Zones {
+		zc := &cfg.Zones[i]
+		if zc.File != "" && !filepath.IsAbs(zc.File) {
+			zc.File = filepath.Join(dir, zc.File)
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return cfg, nil
+}
+
+func parseConfig(buf []byte) (*Config, error) {
+	cfg := &Config{}
+
+	if err := yaml.Unmarshal(buf, &cfg.global); err != nil {
+		return nil, err
+	}
+
+	zones, ok := cfg.global[configZonesKey]
+	if !ok {
+		return cfg, nil
+	}
+	delete(cfg.global, configZonesKey)
+
+	// decode again to catch typos in zone settings
+	zbuf, err := yaml.Marshal(zones)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(zbuf))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg.Zones); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", configZonesKey, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	seen := make(map[string]int)
+	for i, zc := range c.Zones {
+		if err := zc.FileConfig().Validate(); err != nil {
+			return fmt.Errorf("zones[%d]: %w", i, err)
+		}
+
+		st, err := os.Stat(zc.File)
+		if err != nil {
+			return fmt.Errorf("zones[%d]: %w", i, err)
+		}
+		if st.IsDir() {
+			return fmt.Errorf("zones[%d]: %s is a directory", i, zc.File)
+		}
+
+		if prev, ok := seen[filepath.Clean(zc.File)]; ok {
+			return fmt.Errorf("zones[%d]: %s is already configured by zones[%d]", i, zc.File, prev)
+		}
+		seen[filepath.Clean(zc.File)] = i
+	}
+
+	return nil
+}
+
+// FileConfig converts the settings for the zone controller.
+func (zc ZoneConfig) FileConfig() zone.FileConfig {
+	ret := zone.FileConfig{
+		Path:         zc.File,
+		AcmeTTL:      zc.AcmeTTL,
+		DefaultTTL:   zc.DefaultTTL,
+		SerialPolicy: zc.SerialPolicy,
+		Operations:   zc.Operations,
+		Notify:       zc.Notify,
+	}
+	for _, h := range zc.Hooks {
+		ret.Hooks = append(ret.Hooks, zone.Hook{Command: h.Command, Timeout: h.Timeout})
+	}
+
+	return ret
+}
+
+// configLoader is the kong.ConfigurationLoader for --config.
+func configLoader(r io.Reader) (kong.Resolver, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseConfig(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return configResolver(cfg.global), nil
+}
+
+// configResolver resolves flags from the config file.
+type configResolver map[string]any
+
+// Validate rejects keys which are not flags, so typos do not pass silently.
+func (r configResolver) Validate(app *kong.Application) error {
+	flags := make(map[string]bool)
+	var walk func(n *kong.Node)
+	walk = func(n *kong.Node) {
+		for _, f := range n.Flags {
+			flags[f.Name] = true
+		}
+		for _, ch := range n.Children {
+			walk(ch)
+		}
+	}
+	walk(app.Node)
+
+	return checkConfigKeys(r, "", flags)
+}
+
+func checkConfigKeys(values map[string]any, prefix string, flags map[string]bool) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		name := prefix + configKey(k)
+		if flags[name] {
+			continue
+		}
+
+		if sub, ok := values[k].(map[string]any); ok {
+			if err := checkConfigKeys(sub, name+"-", flags); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return fmt.Errorf("unknown config option %q", name)
+	}
+
+	return nil
+}
+
+// Resolve implements kong.Resolver.
+func (r configResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (any, error) {
+	// environment overrides the file, kong applies it before resolvers
+	for _, env := range flag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil
+		}
+	}
+
+	v, ok := lookupConfigKey(r, flag.Name)
+	if !ok {
+		return nil, nil
+	}
+
+	return v, nil
+}
+
+// lookupConfigKey finds the flag name as a key or as nested sections split by "-".
+func lookupConfigKey(values map[string]any, name string) (any, bool) {
+	for k, v := range values {
+		key := configKey(k)
+		if key == name {
+			return v, true
+		}
+
+		if sub, ok := v.(map[string]any); ok && strings.HasPrefix(name, key+"-") {
+			if ret, ok := lookupConfigKey(sub, strings.TrimPrefix(name, key+"-")); ok {
+				return ret, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// configKey allows snake_case keys in the file.
+func configKey(k string) string {
+	return strings.ReplaceAll(k, "_", "-")
+}
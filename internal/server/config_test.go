@@ -0,0 +1,185 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vooon/zoneomatic/internal/zone"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.com.zone"), []byte("$ORIGIN example.com.\n"), 0o600))
+
+	fl := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fl, []byte(content), 0o600))
+
+	return fl
+}
+
+func TestLoadConfig(t *testing.T) {
+	fl := writeTestConfig(t, `
+listen: localhost:8053
+zones:
+  - file: example.com.zone
+    acme_ttl: 0
+    default_ttl: 300
+    serial_policy: date
+    operations: [ddns, acme]
+    hooks:
+      - command: [rndc, reload, example.com]
+        timeout: 30s
+    notify: [192.0.2.53]
+`)
+
+	cfg, err := LoadConfig(fl)
+	require.NoError(t, err)
+	require.Len(t, cfg.Zones, 1)
+
+	acmeTTL := 0
+	assert.Equal(t, zone.FileConfig{
+		Path:         filepath.Join(filepath.Dir(fl), "example.com.zone"),
+		AcmeTTL:      &acmeTTL,
+		DefaultTTL:   300,
+		SerialPolicy: zone.SerialDate,
+		Operations:   []string{zone.OpDDNS, zone.OpACME},
+		Hooks:        []zone.Hook{{Command: []string{"rndc", "reload", "example.com"}, Timeout: 30 * time.Second}},
+		Notify:       []string{"192.0.2.53"},
+	}, cfg.Zones[0].FileConfig())
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "unknown zone key",
+			content: "zones:\n  - file: example.com.zone\n    serial: date\n",
+			errMsg:  "field serial not found",
+		},
+		{
+			name:    "missing file",
+			content: "zones:\n  - file: missing.zone\n",
+			errMsg:  "zones[0]: stat",
+		},
+		{
+			name:    "duplicate file",
+			content: "zones:\n  - file: example.com.zone\n  - file: ./example.com.zone\n",
+			errMsg:  "already configured by zones[0]",
+		},
+		{
+			name:    "bad serial policy",
+			content: "zones:\n  - file: example.com.zone\n    serial_policy: bad\n",
+			errMsg:  "unknown serial policy",
+		},
+		{
+			name:    "bad operation",
+			content: "zones:\n  - file: example.com.zone\n    operations: [axfr]\n",
+			errMsg:  `unknown operation "axfr"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeTestConfig(t, tt.content))
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+type testConfigCli struct {
+	Config kong.ConfigFlag `name:"config"`
+	Listen string          `name:"listen" default:"localhost:9999"`
+	OTEL   struct {
+		Endpoint string `name:"endpoint"`
+		Insecure bool   `name:"insecure"`
+	} `embed:"" prefix:"otel-"`
+}
+
+func parseTestConfig(t *testing.T, content string, args ...string) (*testConfigCli, error) {
+	t.Helper()
+
+	var cli testConfigCli
+	parser, err := kong.New(&cli, kong.DefaultEnvars("ZMTEST"), kong.Configuration(configLoader))
+	require.NoError(t, err)
+
+	_, err = parser.Parse(append([]string{"--config", writeTestConfig(t, content)}, args...))
+	return &cli, err
+}
+
+func TestConfigResolver(t *testing.T) {
+	cli, err := parseTestConfig(t, "otel:\n  endpoint: collector:4317\n  insecure: true\nzones: []\n")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9999", cli.Listen)
+	assert.Equal(t, "collector:4317", cli.OTEL.Endpoint)
+	assert.True(t, cli.OTEL.Insecure)
+
+	cli, err = parseTestConfig(t, "otel_endpoint: collector:4317\n")
+	require.NoError(t, err)
+	assert.Equal(t, "collector:4317", cli.OTEL.Endpoint)
+
+	_, err = parseTestConfig(t, "otel:\n  endpont: collector:4317\n")
+	assert.ErrorContains(t, err, `unknown config option "otel-endpont"`)
+}
+
+func TestConfigResolver_Precedence(t *testing.T) {
+	content := "listen: file:53\notel:\n  endpoint: file:4317\n"
+
+	t.Setenv("ZMTEST_LISTEN", "env:53")
+	cli, err := parseTestConfig(t, content)
+	require.NoError(t, err)
+	assert.Equal(t, "env:53", cli.Listen)
+	assert.Equal(t, "file:4317", cli.OTEL.Endpoint)
+
+	cli, err = parseTestConfig(t, content, "--listen", "flag:53")
+	require.NoError(t, err)
+	assert.Equal(t, "flag:53", cli.Listen)
+}
+
+func TestServeCmd_ZoneConfigs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"db.example.com", "db.example.org", "README"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	cmd := &ServeCmd{
+		ZoneFiles:   []string{filepath.Join(dir, "db.example.org")},
+		ZoneDir:     dir,
+		ZonePattern: "db.*",
+	}
+	zones, err := cmd.zoneConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, []zone.FileConfig{
+		{Path: filepath.Join(dir, "db.example.org")},
+		{Path: filepath.Join(dir, "db.example.com")},
+	}, zones)
+
+	// an empty directory is fine, zones may come later
+	cmd = &ServeCmd{ZoneDir: t.TempDir(), ZonePattern: "*.zone"}
+	zones, err = cmd.zoneConfigs()
+	require.NoError(t, err)
+	assert.Empty(t, zones)
+
+	cmd = &ServeCmd{ZoneDir: dir, ZonePattern: "["}
+	_, err = cmd.zoneConfigs()
+	assert.Error(t, err)
+
+	_, err = (&ServeCmd{}).zoneConfigs()
+	assert.ErrorContains(t, err, "no zones configured")
+}
+
+func TestServeCmd_Validate(t *testing.T) {
+	assert.NoError(t, (&ServeCmd{BcryptCost: 10}).Validate())
+	assert.ErrorContains(t, (&ServeCmd{BcryptCost: 3}).Validate(), "--bcrypt-cost must be between 4 and 31")
+	assert.ErrorContains(t, (&ServeCmd{BcryptCost: 32}).Validate(), "--bcrypt-cost must be between 4 and 31")
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+var ErrAddressNotAllowed = errors.New("address not allowed")
+
+// Special-purpose address classes used in DDNS address policies
+const (
+	AddrPrivate       = "private"
+	AddrCGNAT         = "cgnat"
+	AddrLoopback      = "loopback"
+	AddrLinkLocal     = "link-local"
+	AddrULA           = "ula"
+	AddrDocumentation = "documentation"
+	AddrMulticast     = "multicast"
+	AddrReserved      = "reserved"
+	// AddrBogon is all of the above
+	AddrBogon = "bogon"
+)
+
+var addrClasses = map[string][]netip.Prefix{
+	AddrPrivate:       mustParsePrefixes("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"),
+	AddrCGNAT:         mustParsePrefixes("100.64.0.0/10"),
+	AddrLoopback:      mustParsePrefixes("127.0.0.0/8", "::1/128"),
+	AddrLinkLocal:     mustParsePrefixes("169.254.0.0/16", "fe80::/10"),
+	AddrULA:           mustParsePrefixes("fc00::/7"),
+	AddrDocumentation: mustParsePrefixes("192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32", "3fff::/20"),
+	AddrMulticast:     mustParsePrefixes("224.0.0.0/4", "ff00::/8"),
+	AddrReserved:      mustParsePrefixes("0.0.0.0/8", "240.0.0.0/4", "::/128", "198.18.0.0/15", "192.0.0.0/24", "100::/64"),
+}
+
+var bogonClasses = []string{
+	AddrPrivate, AddrCGNAT, AddrLoopback, AddrLinkLocal, AddrULA, AddrDocumentation, AddrMulticast, AddrReserved,
+}
+
+// AddressPolicy limits addresses published by DDNS updates.
+type AddressPolicy struct {
+	// Deny lists address classes (Addr* constants) to reject
+	Deny []string `json:"deny,omitempty"`
+	// Allow, if set, accepts only addresses within the networks, Deny is not checked then
+	Allow []netip.Prefix `json:"allow,omitempty"`
+}
+
+// DDNSPolicy selects the address policy of the updated name.
+// The exact name wins over the longest matching zone, then Default is used.
+type DDNSPolicy struct {
+	Default AddressPolicy            `json:"default"`
+	Zones   map[string]AddressPolicy `json:"zones,omitempty"`
+	Names   map[string]AddressPolicy `json:"names,omitempty"`
+}
+
+// Check returns ErrAddressNotAllowed if the address is not allowed for the name.
+func (p *DDNSPolicy) Check(name string, addr netip.Addr) error {
+	return p.lookup(name).check(addr)
+}
+
+func (p *DDNSPolicy) lookup(name string) AddressPolicy {
+	name = dns.CanonicalName(name)
+	for n, ap := range p.Names {
+		if dns.CanonicalName(n) == name {
+			return ap
+		}
+	}
+
+	best, bestLabels := p.Default, -1
+	for z, ap := range p.Zones {
+		z = dns.CanonicalName(z)
+		if labels := dns.CountLabel(z); dns.IsSubDomain(z, name) && labels > bestLabels {
+			best, bestLabels = ap, labels
+		}
+	}
+
+	return best
+}
+
+func (p AddressPolicy) check(addr netip.Addr) error {
+	addr = addr.Unmap()
+
+	if len(p.Allow) > 0 {
+		if slices.ContainsFunc(p.Allow, func(pfx netip.Prefix) bool { return pfx.Contains(addr) }) {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s is out of the allowed networks", ErrAddressNotAllowed, addr)
+	}
+
+	if class := addrClass(addr, p.Deny); class != "" {
+		return fmt.Errorf("%w: %s is a %s address", ErrAddressNotAllowed, addr, class)
+	}
+
+	return nil
+}
+
+func (p AddressPolicy) validate() error {
+	for _, class := range p.Deny {
+		if _, ok := addrClasses[class]; !ok && class != AddrBogon {
+			return fmt.Errorf("unknown address class: %s", class)
+		}
+	}
+
+	return nil
+}
+
+// addrClass returns the first of the classes which contains the address.
+func addrClass(addr netip.Addr, classes []string) string {
+	for _, class := range classes {
+		names := []string{class}
+		if class == AddrBogon {
+			names = bogonClasses
+		}
+
+		for _, n := range names {
+			if slices.ContainsFunc(addrClasses[n], func(pfx netip.Prefix) bool { return pfx.Contains(addr) }) {
+				return n
+			}
+		}
+	}
+
+	return ""
+}
+
+// DDNSPolicyFile keeps the DDNS policy in a JSON file.
+type DDNSPolicyFile struct {
+	path    string
+	current atomic.Pointer[DDNSPolicy]
+}
+
+// NewDDNSPolicyFromFile loads the policy.
+func NewDDNSPolicyFromFile(filename string) (*DDNSPolicyFile, error) {
+	ret := &DDNSPolicyFile{path: filename}
+	if err := ret.load(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (f *DDNSPolicyFile) load() error {
+	buf, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	var p DDNSPolicy
+	if err := json.Unmarshal(buf, &p); err != nil {
+		return fmt.Errorf("parse ddns policy: %w", err)
+	}
+
+	errs := []error{p.Default.validate()}
+	for _, ap := range p.Zones {
+		errs = append(errs, ap.validate())
+	}
+	for _, ap := range p.Names {
+		errs = append(errs, ap.validate())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("ddns policy: %w", err)
+	}
+
+	f.current.Store(&p)
+	return nil
+}
+
+// Reload reads the file again. On error current policy is kept.
+func (f *DDNSPolicyFile) Reload() error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	slog.Info("DDNS policy reloaded", "file", f.path)
+	return nil
+}
+
+// Check implements AddressChecker.
+func (f *DDNSPolicyFile) Check(name string, addr netip.Addr) error {
+	return f.current.Load().Check(name, addr)
+}
+
+// AddressChecker validates addresses of DDNS updates.
+type AddressChecker interface {
+	Check(name string, addr netip.Addr) error
+}
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	ret := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		ret = append(ret, netip.MustParsePrefix(p))
+	}
+
+	return ret
+}
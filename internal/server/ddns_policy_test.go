@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDDNSPolicy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ddns-policy.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{
+		"default": {"deny": ["bogon"]},
+		"zones": {
+			"lan.example.com.": {"deny": ["loopback"]},
+			"office.example.com": {"allow": ["198.51.100.0/24"]}
+		},
+		"names": {
+			"vpn.lan.example.com.": {"deny": ["private", "cgnat"]}
+		}
+	}`), 0600))
+
+	policy, err := NewDDNSPolicyFromFile(filename)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		domain string
+		addr   string
+		ok     bool
+	}{
+		{"public", "home.example.com", "1.2.3.4", true},
+		{"public-v6", "home.example.com", "2a00:1450::1", true},
+		{"private", "home.example.com", "192.168.1.10", false},
+		{"cgnat", "home.example.com", "100.64.1.2", false},
+		{"ula", "home.example.com", "fd00::1", false},
+		{"link-local", "home.example.com", "fe80::1", false},
+		{"mapped-private", "home.example.com", "::ffff:10.0.0.1", false},
+		{"zone-private", "nas.lan.example.com", "192.168.1.10", true},
+		{"zone-loopback", "nas.lan.example.com", "127.0.0.1", false},
+		{"name-over-zone", "vpn.lan.example.com.", "10.8.0.1", false},
+		{"allow-in-range", "pc.office.example.com", "198.51.100.7", true},
+		{"allow-out-of-range", "pc.office.example.com", "1.2.3.4", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Check(tc.domain, netip.MustParseAddr(tc.addr))
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrAddressNotAllowed)
+			}
+		})
+	}
+
+	// unknown class is rejected, previous policy is kept
+	require.NoError(t, os.WriteFile(filename, []byte(`{"default": {"deny": ["nope"]}}`), 0600))
+	assert.Error(t, policy.Reload())
+	assert.Error(t, policy.Check("home.example.com", netip.MustParseAddr("192.168.1.10")))
+}
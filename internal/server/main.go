@@ -2,40 +2,89 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"golang.org/x/crypto/bcrypt"
 
+	"github.com/vooon/zoneomatic/internal/audit"
 	"github.com/vooon/zoneomatic/internal/buildinfo"
 	"github.com/vooon/zoneomatic/internal/htpasswd"
 	"github.com/vooon/zoneomatic/internal/zone"
+	"github.com/vooon/zoneomatic/pkg/fileutil"
 )
 
 type Cli struct {
-	Listen             string           `name:"listen" default:"localhost:9999" help:"Server listen address"`
-	AcceptProxy        bool             `name:"accept-proxy" help:"Accept PROXY protocol"`
-	ProxyHeaderTimeout time.Duration    `name:"proxy-header-timeout" default:"10s" help:"Timeout for PROXY headers"`
-	HTPasswdFile       string           `short:"p" name:"htpasswd" required:"" type:"existingfile" placeholder:"FILE" help:"Passwords file (bcrypt only)"`
-	ZoneFiles          []string         `short:"z" name:"zone" required:"" type:"existingfile" placeholder:"FILE,..." help:"Zone files to update"`
-	AcmeTTL            int              `name:"acme-ttl" default:"0" help:"TTL (seconds) for ACME challenge TXT records; 0 = use zone $TTL"`
-	Debug              bool             `name:"debug" help:"Enable debug logging"`
-	Version            kong.VersionFlag `help:"Print version and exit"`
+	Debug   bool             `name:"debug" help:"Enable debug logging"`
+	Version kong.VersionFlag `help:"Print version and exit"`
+
+	Serve ServeCmd `cmd:"" default:"withargs" help:"Run the update server (default command)"`
+	Token TokenCmd `cmd:"" help:"Manage API tokens"`
+}
+
+type ServeCmd struct {
+	Config             kong.ConfigFlag `name:"config" placeholder:"FILE" help:"YAML configuration file with global settings and per-zone settings"`
+	Listen             string          `name:"listen" default:"localhost:9999" help:"Server listen address"`
+	AcceptProxy        bool            `name:"accept-proxy" help:"Accept PROXY protocol"`
+	ProxyHeaderTimeout time.Duration   `name:"proxy-header-timeout" default:"10s" help:"Timeout for PROXY headers"`
+	HTPasswdFile       string          `short:"p" name:"htpasswd" required:"" type:"existingfile" placeholder:"FILE" help:"Passwords file (bcrypt, argon2id, sha256/sha512-crypt, apr1)"`
+	HTPasswdInsecure   bool            `name:"htpasswd-allow-insecure" help:"Also accept plaintext and {SHA} passwords"`
+	HTPasswdCacheTTL   time.Duration   `name:"htpasswd-cache-ttl" default:"1m" help:"Cache successful password verifications for this long; 0 disables the cache"`
+	BcryptCost         int             `name:"bcrypt-cost" default:"10" help:"bcrypt cost of passwords set by the user management API"`
+	TokensFile         string          `name:"tokens" type:"path" placeholder:"FILE" help:"API tokens file, managed by the token command"`
+	PolicyFile         string          `name:"policy" type:"existingfile" placeholder:"FILE" help:"Per-user policy file (JSON), e.g. allowed client networks"`
+	TrustedProxies     []netip.Prefix  `name:"auth-trusted-proxy" placeholder:"CIDR" help:"Proxies allowed to set client IP by X-Forwarded-For"`
+	JWTIssuersFile     string          `name:"jwt-issuers" type:"existingfile" placeholder:"FILE" help:"Trusted JWT/OIDC issuers file (JSON)"`
+	DDNSPolicyFile     string          `name:"ddns-policy" type:"existingfile" placeholder:"FILE" help:"DDNS address policy file (JSON), e.g. to reject private addresses"`
+	ZoneFiles          []string        `short:"z" name:"zone" type:"existingfile" placeholder:"FILE,..." help:"Zone files to update"`
+	ZoneDir            string          `name:"zone-dir" type:"existingdir" placeholder:"DIR" help:"Directory of zone files to update; added and deleted files are picked up while running"`
+	ZonePattern        string          `name:"zone-pattern" default:"*.zone" help:"File name pattern of zone files in --zone-dir, e.g. db.*"`
+	AcmeTTL            int             `name:"acme-ttl" default:"0" help:"TTL (seconds) for ACME challenge TXT records; 0 = use zone $TTL"`
+	LockTimeout        time.Duration   `name:"lock-timeout" default:"10s" help:"Wait for the zone file lock held by other processes (e.g. dnsfmt); 0 disables file locks"`
+	AuditLog           string          `name:"audit-log" type:"path" placeholder:"FILE" help:"Append every zone change as a JSON line to the file"`
+	AuditOTel          bool            `name:"audit-otel" help:"Also emit audit entries as OpenTelemetry logs (with --otel-enable-logs)"`
+	WatchInterval      time.Duration   `name:"watch-interval" default:"10s" help:"Poll interval to reload changed credential, policy and TLS files; 0 = reload on SIGHUP only"`
+
+	AuthLimit AuthLimitConfig `embed:"" prefix:"auth-"`
+	TLS       TLSConfig       `embed:"" prefix:"tls-"`
+	Git       GitConfig       `embed:"" prefix:"git-"`
+
+	Prometheus PrometheusConfig `embed:"" prefix:"prometheus-"`
 
 	OTEL OTelConfig `embed:"" prefix:"otel-"`
 }
 
+type AuthLimitConfig struct {
+	FailBurst  int           `name:"fail-burst" default:"10" help:"Failed attempts allowed per client IP and per user before lockout; 0 disables the limit"`
+	FailRefill time.Duration `name:"fail-refill" default:"1m" help:"Period to forgive one failed attempt"`
+	Lockout    time.Duration `name:"lockout" default:"1m" help:"First lockout duration, doubled on each next lockout"`
+	LockoutMax time.Duration `name:"lockout-max" default:"1h" help:"Maximum lockout duration"`
+}
+
+type GitConfig struct {
+	Commit       bool   `name:"commit" help:"Commit every zone change to the git repository of the zone file"`
+	Push         string `name:"push" placeholder:"REMOTE" help:"Push commits to the remote in background (with --git-commit)"`
+	AuthorDomain string `name:"author-domain" placeholder:"DOMAIN" help:"Commit author email domain, user@DOMAIN; empty = no email"`
+}
+
 func Main() {
 	var cli Cli
 
 	kctx := kong.Parse(&cli,
 		kong.Description("DNS Zone file updater"),
 		kong.DefaultEnvars("ZM"),
+		kong.Configuration(configLoader),
 		kong.Vars{"version": buildinfo.String()},
 	)
 
@@ -51,8 +100,36 @@ func Main() {
 	// Keep default stderr logging in place even when OTel logs are enabled.
 	slog.SetDefault(slog.New(baseHandler))
 
-	otelShutdown, err := setupTelemetry(context.Background(), cli.OTEL, cli.Debug)
-	kctx.FatalIfErrorf(err)
+	kctx.BindTo(baseHandler, (*slog.Handler)(nil))
+	kctx.FatalIfErrorf(kctx.Run(&cli))
+}
+
+// Validate checks flags kong cannot check by itself.
+func (cmd *ServeCmd) Validate() error {
+	if cmd.BcryptCost < bcrypt.MinCost || cmd.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("--bcrypt-cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cmd.BcryptCost)
+	}
+
+	return nil
+}
+
+func (cmd *ServeCmd) Run(cli *Cli, baseHandler slog.Handler) error {
+	var metricReaders []sdkmetric.Reader
+	var metricsHandler http.Handler
+	if cmd.Prometheus.Enabled {
+		reader, h, err := newPrometheusReader()
+		if err != nil {
+			return err
+		}
+
+		metricReaders = append(metricReaders, reader)
+		metricsHandler = h
+	}
+
+	otelShutdown, err := setupTelemetry(context.Background(), cmd.OTEL, cli.Debug, metricReaders...)
+	if err != nil {
+		return err
+	}
 	if otelShutdown.LogHandler != nil {
 		slog.SetDefault(slog.New(newTeeSlogHandler(baseHandler, otelShutdown.LogHandler)))
 	}
@@ -68,18 +145,153 @@ func Main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	zctl, err := zone.NewWithOptions([]zone.Option{zone.WithAcmeTTL(cli.AcmeTTL)}, cli.ZoneFiles...)
-	kctx.FatalIfErrorf(err)
+	zoneOpts := []zone.Option{
+		zone.WithAcmeTTL(cmd.AcmeTTL),
+		zone.WithLockTimeout(cmd.LockTimeout),
+	}
+	var auditLog *audit.FileLog
+	if cmd.AuditLog != "" {
+		var auditOpts []audit.Option
+		if cmd.AuditOTel {
+			auditOpts = append(auditOpts, audit.WithOTelLogs())
+		}
+
+		auditLog, err = audit.Open(cmd.AuditLog, auditOpts...)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close() // nolint:errcheck
+
+		zoneOpts = append(zoneOpts, zone.WithAuditLog(auditLog))
+	}
+	if cmd.Git.Commit {
+		zoneOpts = append(zoneOpts, zone.WithGitCommit(zone.GitConfig{
+			Remote:       cmd.Git.Push,
+			AuthorDomain: cmd.Git.AuthorDomain,
+		}))
+	}
+
+	zoneConfigs, err := cmd.zoneConfigs()
+	if err != nil {
+		return err
+	}
+
+	zctl, err := zone.NewWithConfigs(zoneOpts, zoneConfigs...)
+	if err != nil {
+		return err
+	}
+
+	htp, err := htpasswd.NewFromFile(cmd.HTPasswdFile,
+		htpasswd.WithInsecureHashes(cmd.HTPasswdInsecure),
+		htpasswd.WithBcryptCost(cmd.BcryptCost),
+		htpasswd.WithCacheTTL(cmd.HTPasswdCacheTTL),
+	)
+	if err != nil {
+		return err
+	}
+
+	reloadables := []reloadable{
+		{name: "htpasswd", path: cmd.HTPasswdFile, r: htp},
+		newZoneReloadable(cmd, zctl),
+	}
+
+	opts := []Option{
+		WithTrustedProxies(cmd.TrustedProxies),
+		WithUserStore(htp),
+		WithReadyCheck("htpasswd", fileReadable(cmd.HTPasswdFile)),
+	}
+	if auditLog != nil {
+		opts = append(opts, WithAuditLog(auditLog))
+	}
+	if cmd.PolicyFile != "" {
+		policies, err := htpasswd.NewPolicyFromFile(cmd.PolicyFile)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, WithPolicies(policies))
+		reloadables = append(reloadables, reloadable{name: "policy", path: cmd.PolicyFile, r: policies})
+	}
+
+	if cmd.TokensFile != "" {
+		tokens, err := htpasswd.NewTokensFromFile(cmd.TokensFile)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("API tokens loaded", "count", len(tokens.List()))
+		opts = append(opts, WithTokens(tokens))
+		reloadables = append(reloadables, reloadable{name: "tokens", path: cmd.TokensFile, r: tokens})
+	}
+
+	if cmd.JWTIssuersFile != "" {
+		issuers, err := htpasswd.NewJWTIssuersFromFile(cmd.JWTIssuersFile)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, WithJWT(issuers))
+		for _, f := range issuers.JWKSFiles() {
+			reloadables = append(reloadables, reloadable{name: "jwks", path: f, r: issuers})
+		}
+	}
 
-	htp, err := htpasswd.NewFromFile(cli.HTPasswdFile)
-	kctx.FatalIfErrorf(err)
+	if cmd.DDNSPolicyFile != "" {
+		ddnsPolicy, err := NewDDNSPolicyFromFile(cmd.DDNSPolicyFile)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, WithDDNSPolicy(ddnsPolicy))
+		reloadables = append(reloadables, reloadable{name: "ddns-policy", path: cmd.DDNSPolicyFile, r: ddnsPolicy})
+	}
 
-	srv, listener, err := NewServer(&cli)
-	kctx.FatalIfErrorf(err)
+	if cmd.AuthLimit.FailBurst > 0 {
+		opts = append(opts, WithAuthLimiter(htpasswd.NewLimiter(htpasswd.LimiterConfig{
+			Burst:      cmd.AuthLimit.FailBurst,
+			Refill:     cmd.AuthLimit.FailRefill,
+			Lockout:    cmd.AuthLimit.Lockout,
+			MaxLockout: cmd.AuthLimit.LockoutMax,
+		})))
+	}
+
+	var tlsConfig *tls.Config
+	if cmd.TLS.Enabled() {
+		certs, err := newTLSCertificates(cmd.TLS)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig = certs.Config()
+		reloadables = append(reloadables, certs.reloadables()...)
+		if cmd.TLS.ClientCA != "" {
+			opts = append(opts, WithClientCerts(cmd.TLS.ClientUser))
+		}
+	}
+
+	go reloadFiles(ctx, cmd.WatchInterval, reloadables...)
+
+	if metricsHandler != nil {
+		if cmd.Prometheus.Listen == "" {
+			opts = append(opts, WithMetrics(metricsHandler, cmd.Prometheus.Auth))
+		} else {
+			h := NewMetricsHandler(htp, metricsHandler, cmd.Prometheus.Auth, opts...)
+			go func() {
+				if err := serveMetrics(ctx, cmd.Prometheus.Listen, h); err != nil {
+					slog.Error("Metrics listener failed", "error", err)
+				}
+			}()
+		}
+	}
+
+	srv, listener, err := NewServer(cmd, tlsConfig)
+	if err != nil {
+		return err
+	}
 
 	defer listener.Close() // nolint:errcheck
 
-	RegisterEndpoints(srv, htp, zctl)
+	RegisterEndpoints(srv, htp, zctl, opts...)
 
 	go func() {
 		err := srv.Run()
@@ -97,4 +309,60 @@ func Main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		slog.Error("Server shutdown failed", "error", err)
 	}
+
+	return nil
+}
+
+// zoneConfigs returns --zone files, zones of the config file, then new files of --zone-dir.
+func (cmd *ServeCmd) zoneConfigs() ([]zone.FileConfig, error) {
+	ret := make([]zone.FileConfig, 0, len(cmd.ZoneFiles))
+	for _, f := range cmd.ZoneFiles {
+		ret = append(ret, zone.FileConfig{Path: f})
+	}
+
+	if cmd.Config != "" {
+		cfg, err := LoadConfig(string(cmd.Config))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, zc := range cfg.Zones {
+			ret = append(ret, zc.FileConfig())
+		}
+	}
+
+	if cmd.ZoneDir != "" {
+		files, err := fileutil.GlobDir(cmd.ZoneDir, cmd.ZonePattern)
+		if err != nil {
+			return nil, fmt.Errorf("zone dir: %w", err)
+		}
+
+		// explicitly configured files keep their settings
+		known := make(map[string]bool, len(ret))
+		for _, zc := range ret {
+			known[absPath(zc.Path)] = true
+		}
+		for _, f := range files {
+			if !known[absPath(f)] {
+				ret = append(ret, zone.FileConfig{Path: f})
+			}
+		}
+
+		// zones may be added to the directory later
+		return ret, nil
+	}
+
+	if len(ret) == 0 {
+		return nil, errors.New("no zones configured: use --zone, --zone-dir or zones in --config")
+	}
+
+	return ret, nil
+}
+
+func absPath(p string) string {
+	if ret, err := filepath.Abs(p); err == nil {
+		return ret
+	}
+
+	return filepath.Clean(p)
 }
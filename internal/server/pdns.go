@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -12,6 +13,7 @@ import (
 	"github.com/go-fuego/fuego/option"
 
 	"github.com/vooon/zoneomatic/internal/htpasswd"
+	"github.com/vooon/zoneomatic/internal/stats"
 	"github.com/vooon/zoneomatic/internal/zone"
 )
 
@@ -83,10 +85,16 @@ type pdnsPatchZoneRequest struct {
 
 type pdnsNoContentResponse struct{}
 
-func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Controller) {
-	pdnsAuth := htpasswd.NewAPIKeyMiddlewareWithUnauthorized(htp, func(w http.ResponseWriter, r *http.Request) {
+func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Controller, cfg *endpointsConfig) {
+	pdnsAPIKeyAuth := htpasswd.NewAPIKeyMiddlewareWithUnauthorized(htp, func(w http.ResponseWriter, r *http.Request) {
 		sendPDNSError(w, r, http.StatusUnauthorized, "unauthorized")
+	}, cfg.authOpts...)
+	pdnsScope := newEndpointScopeMiddleware(htpasswd.EndpointPDNS, func(w http.ResponseWriter, r *http.Request, msg string) {
+		sendPDNSError(w, r, http.StatusForbidden, msg)
 	})
+	pdnsAuth := func(h http.Handler) http.Handler {
+		return pdnsAPIKeyAuth(pdnsScope(h))
+	}
 	pdnsSecurity := option.Security(openapi3.SecurityRequirement{
 		"pdnsApiKeyAuth": []string{},
 	})
@@ -136,6 +144,9 @@ func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.C
 				if zoneFilter != "" && zoneData.Name != dnsFQDN(zoneFilter) {
 					continue
 				}
+				if !zoneScopeAllowed(ctx, zoneData.Name) {
+					continue
+				}
 
 				result = append(result, zoneSnapshotToPDNSZone(zoneData, false))
 			}
@@ -150,47 +161,115 @@ func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.C
 		option.Query("zone", "Filter zones by fully-qualified zone name"),
 	)
 
-	fuego.Get(srv, "/api/v1/servers/{server_id}/zones/{zone_id}",
-		func(ctx fuego.ContextNoBody) (*pdnsZone, error) {
-			serverID := ctx.PathParam("server_id")
-			if serverID != pdnsServerID {
-				return nil, newPDNSError(http.StatusNotFound, "server not found")
+	fuego.GetStd(srv, "/api/v1/servers/{server_id}/zones/{zone_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			if !requirePDNSServerID(w, r) {
+				return
+			}
+
+			zoneID := r.PathValue("zone_id")
+			if !zoneScopeAllowed(r.Context(), zoneID) {
+				sendPDNSError(w, r, http.StatusForbidden, "token is not allowed to access zone "+zoneID)
+				return
 			}
 
-			zoneData, err := zctl.GetZone(ctx, ctx.PathParam("zone_id"))
+			zoneData, err := zctl.GetZone(r.Context(), zoneID)
 			if err != nil {
 				switch {
 				case errors.Is(err, zone.ErrZoneNotFound):
-					return nil, newPDNSError(http.StatusNotFound, err.Error())
+					sendPDNSError(w, r, http.StatusNotFound, err.Error())
 				case errors.Is(err, zone.ErrRecordNotFound):
-					return nil, newPDNSError(http.StatusNotFound, err.Error())
+					sendPDNSError(w, r, http.StatusNotFound, err.Error())
 				default:
-					return nil, newPDNSError(http.StatusUnprocessableEntity, err.Error())
+					sendPDNSError(w, r, http.StatusUnprocessableEntity, err.Error())
 				}
+				return
 			}
 
-			includeRRsets := !strings.EqualFold(ctx.QueryParam("rrsets"), "false")
-			rrsetName := ctx.QueryParam("rrset_name")
-			rrsetType := ctx.QueryParam("rrset_type")
+			query := r.URL.Query()
+			includeRRsets := !strings.EqualFold(query.Get("rrsets"), "false")
+			rrsetName := query.Get("rrset_name")
+			rrsetType := query.Get("rrset_type")
 			if rrsetType != "" && rrsetName == "" {
-				return nil, newPDNSError(http.StatusUnprocessableEntity, "rrset_type requires rrset_name")
+				sendPDNSError(w, r, http.StatusUnprocessableEntity, "rrset_type requires rrset_name")
+				return
+			}
+
+			etag := pdnsETag(zoneData.Version)
+			w.Header().Set("ETag", etag)
+			if etagNoneMatch(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
 			}
 
 			zoneResp := zoneSnapshotToPDNSZone(zoneData, includeRRsets)
 			if includeRRsets && rrsetName != "" {
 				zoneResp.RRsets = filterPDNSRRsets(zoneResp.RRsets, rrsetName, rrsetType)
 			}
+			if includeRRsets {
+				zoneResp.RRsets = slices.DeleteFunc(zoneResp.RRsets, func(rrset pdnsRRSet) bool {
+					return !nameScopeAllowed(r.Context(), rrset.Name)
+				})
+			}
 
-			return &zoneResp, nil
+			_ = fuego.SendJSON(w, r, zoneResp)
 		},
 		option.OperationID("pdnsGetZone"),
 		option.Summary("pdns get zone"),
-		option.OverrideDescription("Return a managed zone in PowerDNS-compatible format."),
+		option.OverrideDescription("Return a managed zone in PowerDNS-compatible format. The ETag changes with every change of the zone file."),
 		option.Middleware(pdnsAuth),
 		pdnsSecurity,
 		option.QueryBool("rrsets", "Include rrsets in the zone response. Defaults to true."),
 		option.Query("rrset_name", "Filter returned rrsets by fully-qualified record name"),
 		option.Query("rrset_type", "Filter returned rrsets by record type; requires rrset_name"),
+		option.Header("If-None-Match", "Return 304 Not Modified if the zone ETag matches"),
+		option.AddResponse(http.StatusOK, "Zone",
+			fuego.Response{Type: pdnsZone{}},
+		),
+		option.AddResponse(http.StatusNotModified, "Zone not modified",
+			fuego.Response{Type: pdnsNoContentResponse{}},
+		),
+		option.AddResponse(http.StatusUnauthorized, "Unauthorized",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
+		option.AddResponse(http.StatusForbidden, "Token scope does not allow the zone",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
+		option.AddResponse(http.StatusNotFound, "Zone or server not found",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
+		option.AddResponse(http.StatusUnprocessableEntity, "Invalid zone request",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
+	)
+
+	fuego.Get(srv, "/api/v1/servers/{server_id}/statistics",
+		func(ctx fuego.ContextNoBody) ([]pdnsStatisticItem, error) {
+			serverID := ctx.PathParam("server_id")
+			if serverID != pdnsServerID {
+				return nil, newPDNSError(http.StatusNotFound, "server not found")
+			}
+
+			items := statsToPDNSStatistics(stats.Default.Snapshot())
+
+			if name := ctx.QueryParam("statistic"); name != "" {
+				idx := slices.IndexFunc(items, func(it pdnsStatisticItem) bool { return it.Name == name })
+				if idx < 0 {
+					return nil, newPDNSError(http.StatusUnprocessableEntity, "Unknown statistic name")
+				}
+
+				return items[idx : idx+1], nil
+			}
+
+			return items, nil
+		},
+		option.OperationID("pdnsGetStatistics"),
+		option.Summary("pdns statistics"),
+		option.OverrideDescription("Return zoneomatic counters in PowerDNS-compatible statistics format."),
+		option.Middleware(pdnsAuth),
+		pdnsSecurity,
+		option.Query("statistic", "Return only the statistic with this name"),
+		option.QueryBool("includerings", "Accepted for compatibility; zoneomatic has no ring statistics."),
 	)
 
 	fuego.PatchStd(srv, "/api/v1/servers/{server_id}/zones/{zone_id}",
@@ -207,61 +286,92 @@ func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.C
 				return
 			}
 
+			stats.Default.RecordUpdate(r.Context(), "pdns")
+
 			zoneName := r.PathValue("zone_id")
+			changes := make([]zone.RRSetChange, 0, len(req.RRsets))
 			for _, rrset := range req.RRsets {
 				if rrset.Name == "" || rrset.Type == "" {
 					sendPDNSError(w, r, http.StatusUnprocessableEntity, "rrset name and type are required")
 					return
 				}
+				if msg := nameScopeViolation(r.Context(), rrset.Name); msg != "" {
+					sendPDNSError(w, r, http.StatusForbidden, msg)
+					return
+				}
 
-				switch strings.ToUpper(strings.TrimSpace(rrset.ChangeType)) {
-				case "DELETE":
-					if _, err := zctl.DeleteRRSet(r.Context(), zoneName, rrset.Name, rrset.Type); err != nil {
-						sendPDNSZoneError(w, r, err)
-						return
+				change := zone.RRSetChange{
+					ChangeType: strings.ToUpper(strings.TrimSpace(rrset.ChangeType)),
+					Name:       rrset.Name,
+					Type:       rrset.Type,
+					TTL:        rrset.TTL,
+				}
+				for _, record := range rrset.Records {
+					if record.Disabled {
+						change.Disabled = append(change.Disabled, record.Content)
+						continue
 					}
-				case "REPLACE":
-					if len(rrset.Records) == 0 {
-						if _, err := zctl.DeleteRRSet(r.Context(), zoneName, rrset.Name, rrset.Type); err != nil {
-							sendPDNSZoneError(w, r, err)
-							return
-						}
 
-						continue
+					change.Records = append(change.Records, record.Content)
+				}
+
+				switch change.ChangeType {
+				case zone.ChangeDelete:
+				case zone.ChangeReplace:
+					if len(rrset.Records) == 0 {
+						change.ChangeType = zone.ChangeDelete
+						break
 					}
 
 					if rrset.TTL <= 0 {
 						sendPDNSError(w, r, http.StatusUnprocessableEntity, "ttl must be greater than zero for REPLACE")
 						return
 					}
-
-					values := make([]string, 0, len(rrset.Records))
-					for _, record := range rrset.Records {
-						if record.Disabled {
-							sendPDNSError(w, r, http.StatusNotImplemented, "disabled records are not supported")
-							return
-						}
-
-						values = append(values, record.Content)
+				case zone.ChangeExtend:
+					if len(rrset.Records) == 0 {
+						sendPDNSError(w, r, http.StatusUnprocessableEntity, "records are required for EXTEND")
+						return
 					}
-
-					if _, err := zctl.ReplaceRRSet(r.Context(), zoneName, rrset.Name, rrset.Type, rrset.TTL, values); err != nil {
-						sendPDNSZoneError(w, r, err)
+					if rrset.TTL <= 0 {
+						sendPDNSError(w, r, http.StatusUnprocessableEntity, "ttl must be greater than zero for EXTEND")
+						return
+					}
+				case zone.ChangePrune:
+					if len(rrset.Records) == 0 {
+						sendPDNSError(w, r, http.StatusUnprocessableEntity, "records are required for PRUNE")
 						return
 					}
 				default:
 					sendPDNSError(w, r, http.StatusNotImplemented, "unsupported changetype: "+rrset.ChangeType)
 					return
 				}
+
+				changes = append(changes, change)
+			}
+
+			ctx := r.Context()
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && strings.TrimSpace(ifMatch) != "*" {
+				versions := etagVersions(ifMatch)
+				if len(versions) == 0 {
+					sendPDNSError(w, r, http.StatusPreconditionFailed, "If-Match has no strong ETag")
+					return
+				}
+				ctx = zone.WithIfVersion(ctx, versions...)
+			}
+
+			if _, err := zctl.PatchRRSets(ctx, zoneName, changes); err != nil {
+				sendPDNSZoneError(w, r, err)
+				return
 			}
 
 			w.WriteHeader(http.StatusNoContent)
 		},
 		option.OperationID("pdnsPatchZone"),
 		option.Summary("pdns patch zone"),
-		option.OverrideDescription("Replace or delete managed RRSets in PowerDNS-compatible format."),
+		option.OverrideDescription("Replace, delete, extend or prune managed RRSets in PowerDNS-compatible format. All changes are applied atomically."),
 		option.Middleware(pdnsAuth),
 		pdnsSecurity,
+		option.Header("If-Match", "Apply changes only if the zone ETag matches"),
 		option.RequestBody(
 			fuego.RequestBody{
 				Type:         new(pdnsPatchZoneRequest),
@@ -277,9 +387,15 @@ func registerPDNSEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.C
 		option.AddResponse(http.StatusUnauthorized, "Unauthorized",
 			fuego.Response{Type: new(pdnsHTTPError)},
 		),
+		option.AddResponse(http.StatusForbidden, "Token scope does not allow the change",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
 		option.AddResponse(http.StatusNotFound, "Zone or server not found",
 			fuego.Response{Type: new(pdnsHTTPError)},
 		),
+		option.AddResponse(http.StatusPreconditionFailed, "Zone ETag does not match If-Match",
+			fuego.Response{Type: new(pdnsHTTPError)},
+		),
 		option.AddResponse(http.StatusUnprocessableEntity, "Invalid rrset request",
 			fuego.Response{Type: new(pdnsHTTPError)},
 		),
@@ -374,10 +490,13 @@ func zoneSnapshotToPDNSZone(zoneData zone.ZoneSnapshot, includeRRsets bool) pdns
 	if includeRRsets {
 		resp.RRsets = make([]pdnsRRSet, 0, len(zoneData.RRsets))
 		for _, rrset := range zoneData.RRsets {
-			records := make([]pdnsRecord, 0, len(rrset.Records))
+			records := make([]pdnsRecord, 0, len(rrset.Records)+len(rrset.DisabledRecords))
 			for _, record := range rrset.Records {
 				records = append(records, pdnsRecord{Content: record, Disabled: false})
 			}
+			for _, record := range rrset.DisabledRecords {
+				records = append(records, pdnsRecord{Content: record, Disabled: true})
+			}
 
 			resp.RRsets = append(resp.RRsets, pdnsRRSet{
 				Name:    rrset.Name,
@@ -425,11 +544,51 @@ func sendPDNSZoneError(w http.ResponseWriter, r *http.Request, err error) {
 		sendPDNSError(w, r, http.StatusNotFound, err.Error())
 	case errors.Is(err, zone.ErrRecordNotFound):
 		sendPDNSError(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, zone.ErrOperationNotAllowed):
+		sendPDNSError(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, zone.ErrZoneLocked):
+		sendPDNSError(w, r, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, zone.ErrZoneConflict):
+		sendPDNSError(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, zone.ErrVersionMismatch):
+		sendPDNSError(w, r, http.StatusPreconditionFailed, err.Error())
 	default:
 		sendPDNSError(w, r, http.StatusUnprocessableEntity, err.Error())
 	}
 }
 
+// pdnsETag returns the strong ETag of the zone version.
+func pdnsETag(version string) string {
+	return `"` + version + `"`
+}
+
+// etagNoneMatch checks an If-None-Match header value against the ETag, W/ prefixes are ignored.
+func etagNoneMatch(header, etag string) bool {
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagVersions returns zone versions of strong ETags in an If-Match header value,
+// weak ETags never match If-Match.
+func etagVersions(header string) []string {
+	var versions []string
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		versions = append(versions, tag[1:len(tag)-1])
+	}
+
+	return versions
+}
+
 func sendPDNSError(w http.ResponseWriter, r *http.Request, status int, msg string, errs ...string) {
 	fuego.SendJSONError(w, r, newPDNSError(status, msg, errs...))
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/vooon/zoneomatic/internal/stats"
+)
+
+// pdnsStatisticItem is either StatisticItem (string value) or MapStatisticItem (list value).
+type pdnsStatisticItem struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type pdnsSimpleStatisticItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func statsToPDNSStatistics(snap stats.Snapshot) []pdnsStatisticItem {
+	total := snap.TotalSize()
+	zoneNames := snap.ZoneNames()
+
+	updates := make([]pdnsSimpleStatisticItem, 0, len(snap.Updates))
+	for _, endpoint := range slices.Sorted(maps.Keys(snap.Updates)) {
+		updates = append(updates, pdnsSimpleStatisticItem{Name: endpoint, Value: formatUint(snap.Updates[endpoint])})
+	}
+
+	zoneRRsets := make([]pdnsSimpleStatisticItem, 0, len(zoneNames))
+	zoneRecords := make([]pdnsSimpleStatisticItem, 0, len(zoneNames))
+	for _, name := range zoneNames {
+		size := snap.Zones[name]
+		zoneRRsets = append(zoneRRsets, pdnsSimpleStatisticItem{Name: name, Value: strconv.Itoa(size.RRsets)})
+		zoneRecords = append(zoneRecords, pdnsSimpleStatisticItem{Name: name, Value: strconv.Itoa(size.Records)})
+	}
+
+	lastWrite := make([]pdnsSimpleStatisticItem, 0, len(snap.LastWrite))
+	for _, name := range slices.Sorted(maps.Keys(snap.LastWrite)) {
+		lastWrite = append(lastWrite, pdnsSimpleStatisticItem{Name: name, Value: strconv.FormatInt(snap.LastWrite[name].Unix(), 10)})
+	}
+
+	return []pdnsStatisticItem{
+		pdnsStatistic("uptime", strconv.FormatInt(int64(snap.Uptime.Seconds()), 10)),
+		pdnsStatistic("zm-zones", strconv.Itoa(len(zoneNames))),
+		pdnsStatistic("zm-rrsets", strconv.Itoa(total.RRsets)),
+		pdnsStatistic("zm-records", strconv.Itoa(total.Records)),
+		pdnsStatistic("zm-writes-changed", formatUint(snap.WritesChanged)),
+		pdnsStatistic("zm-writes-unchanged", formatUint(snap.WritesUnchanged)),
+		pdnsStatistic("zm-writes-failed", formatUint(snap.WritesFailed)),
+		pdnsStatistic("zm-auth-failures", formatUint(snap.AuthFailures)),
+		pdnsStatistic("zm-auth-blocked", formatUint(snap.AuthBlocked)),
+		pdnsMapStatistic("zm-updates", updates),
+		pdnsMapStatistic("zm-zone-rrsets", zoneRRsets),
+		pdnsMapStatistic("zm-zone-records", zoneRecords),
+		pdnsMapStatistic("zm-zone-last-write", lastWrite),
+	}
+}
+
+func pdnsStatistic(name, value string) pdnsStatisticItem {
+	return pdnsStatisticItem{Name: name, Type: "StatisticItem", Value: value}
+}
+
+func pdnsMapStatistic(name string, value []pdnsSimpleStatisticItem) pdnsStatisticItem {
+	return pdnsStatisticItem{Name: name, Type: "MapStatisticItem", Value: value}
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
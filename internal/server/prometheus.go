@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-fuego/fuego"
+	"github.com/go-fuego/fuego/option"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/vooon/zoneomatic/internal/htpasswd"
+)
+
+const metricsPath = "/metrics"
+
+type PrometheusConfig struct {
+	Enabled bool   `name:"enable" help:"Serve metrics for Prometheus scraping at /metrics"`
+	Listen  string `name:"listen" placeholder:"ADDR" help:"Separate listen address for /metrics (e.g. :9464); empty = main listener"`
+	Auth    bool   `name:"auth" help:"Require authentication to scrape /metrics"`
+}
+
+// newPrometheusReader returns the metric reader for the MeterProvider and the handler serving collected metrics.
+func newPrometheusReader() (sdkmetric.Reader, http.Handler, error) {
+	reg := prometheus.NewRegistry()
+
+	exp, err := otelprom.New(otelprom.WithRegisterer(reg))
+	if err != nil {
+		return nil, nil, fmt.Errorf("init prometheus exporter: %w", err)
+	}
+
+	return exp, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), nil
+}
+
+// WithMetrics serves Prometheus metrics at /metrics of the main listener.
+func WithMetrics(h http.Handler, auth bool) Option {
+	return func(c *endpointsConfig) {
+		c.metrics = h
+		c.metricsAuth = auth
+	}
+}
+
+// NewMetricsHandler wraps the metrics handler with authentication, if required.
+// Auth options are taken from opts, so credentials are the same as of the main listener.
+func NewMetricsHandler(htp htpasswd.HTPasswd, h http.Handler, auth bool, opts ...Option) http.Handler {
+	cfg := &endpointsConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg.metricsHandler(htp, h, auth)
+}
+
+func (c *endpointsConfig) metricsHandler(htp htpasswd.HTPasswd, h http.Handler, auth bool) http.Handler {
+	if !auth {
+		return h
+	}
+
+	return htpasswd.NewBasicAuthMiddleware(htp, c.authOpts...)(h)
+}
+
+func registerMetricsEndpoint(srv *fuego.Server, htp htpasswd.HTPasswd, cfg *endpointsConfig) {
+	if cfg.metrics == nil {
+		return
+	}
+
+	opts := []fuego.RouteOption{
+		option.Summary("metrics"),
+		option.Description("Prometheus metrics in text exposition format"),
+	}
+	if cfg.metricsAuth {
+		opts = append(opts, option.Security(openapi3.SecurityRequirement{"basicAuth": []string{}}))
+	}
+
+	fuego.GetStd(srv, metricsPath, cfg.metricsHandler(htp, cfg.metrics, cfg.metricsAuth).ServeHTTP, opts...)
+}
+
+// serveMetrics runs a separate metrics listener until ctx is done.
+func serveMetrics(ctx context.Context, addr string, h http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+metricsPath, h)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Prometheus metrics listener", "listen", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
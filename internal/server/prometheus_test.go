@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	reader, h, err := newPrometheusReader()
+	require.NoError(t, err)
+
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+
+	counter, err := mp.Meter("test").Int64Counter("zoneomatic.test.requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+
+	tcs := []struct {
+		name     string
+		auth     bool
+		user     string
+		expected int
+	}{
+		{name: "no auth", expected: http.StatusOK},
+		{name: "auth required", auth: true, expected: http.StatusUnauthorized},
+		{name: "auth ok", auth: true, user: "u", expected: http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(htp, &fakeZoneController{}, WithMetrics(h, tc.auth))
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, "p")
+			}
+			rec := httptest.NewRecorder()
+			srv.Mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				assert.Regexp(t, `zoneomatic_test_requests_total\{[^}]*\} 3`, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewMetricsHandler(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	h := NewMetricsHandler(htp, ok, true)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("u", "p")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-fuego/fuego"
+	"github.com/go-fuego/fuego/option"
+
+	"github.com/vooon/zoneomatic/internal/zone"
+)
+
+// readyCacheTTL limits how often /ready checks run: the endpoint has no authentication
+// and the zone check holds the zone lock for a full load.
+const readyCacheTTL = 5 * time.Second
+
+// Readiness statuses
+const (
+	ReadyOK   = "ok"
+	ReadyFail = "fail"
+)
+
+// ReadyZone is the zone check result. Errors are only logged, /ready has no authentication
+// and they include file paths.
+type ReadyZone struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type ReadyCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type ReadyResponse struct {
+	Status string       `json:"status"`
+	Zones  []ReadyZone  `json:"zones"`
+	Checks []ReadyCheck `json:"checks,omitempty"`
+}
+
+// readyCheck is an additional readiness check, like readability of the credentials file.
+type readyCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// WithReadyCheck adds a named check to the /ready endpoint.
+func WithReadyCheck(name string, check func(ctx context.Context) error) Option {
+	return func(c *endpointsConfig) {
+		c.readyChecks = append(c.readyChecks, readyCheck{name: name, check: check})
+	}
+}
+
+// fileReadable returns a check that the file can be opened for reading.
+func fileReadable(filename string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+
+		return f.Close()
+	}
+}
+
+// readyCache shares the last result between /ready requests, concurrent requests wait for one check.
+type readyCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	resp    *ReadyResponse
+}
+
+func (c *readyCache) get(ctx context.Context, check func(ctx context.Context) *ReadyResponse) *ReadyResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resp == nil || time.Since(c.checked) >= readyCacheTTL {
+		c.resp = check(ctx)
+		c.checked = time.Now()
+	}
+
+	return c.resp
+}
+
+func readyStatus(err error) string {
+	if err != nil {
+		return ReadyFail
+	}
+
+	return ReadyOK
+}
+
+func registerReadyEndpoint(srv *fuego.Server, zctl zone.Controller, cfg *endpointsConfig) {
+	checks := cfg.readyChecks
+
+	check := func(ctx context.Context) *ReadyResponse {
+		ret := &ReadyResponse{Status: ReadyOK, Zones: make([]ReadyZone, 0)}
+
+		for _, st := range zctl.CheckZones(ctx) {
+			if st.Err != nil {
+				slog.WarnContext(ctx, "Zone is not ready", "zone", st.Name, "zone_file", st.File, "error", st.Err)
+				ret.Status = ReadyFail
+			}
+
+			ret.Zones = append(ret.Zones, ReadyZone{Name: st.Name, Status: readyStatus(st.Err)})
+		}
+
+		for _, c := range checks {
+			err := c.check(ctx)
+			if err != nil {
+				slog.WarnContext(ctx, "Readiness check failed", "check", c.name, "error", err)
+				ret.Status = ReadyFail
+			}
+
+			ret.Checks = append(ret.Checks, ReadyCheck{Name: c.name, Status: readyStatus(err)})
+		}
+
+		return ret
+	}
+	cache := &readyCache{}
+
+	fuego.Get(srv, "/ready",
+		func(ctx fuego.ContextNoBody) (*ReadyResponse, error) {
+			ret := cache.get(ctx, check)
+			if ret.Status != ReadyOK {
+				ctx.SetStatus(http.StatusServiceUnavailable)
+			}
+
+			return ret, nil
+		},
+		option.Summary("ready"),
+		option.Description("Readiness check: every zone file parses, has SOA and the same origin, and its directory is writable. The result is cached for 5 seconds, failure reasons are logged."),
+		option.AddResponse(http.StatusServiceUnavailable, "Some check failed", fuego.Response{Type: new(ReadyResponse)}),
+	)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vooon/zoneomatic/internal/zone"
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+// reloader is a file backed configuration which can be re-read at runtime.
+type reloader interface {
+	// Reload must keep the current state on error.
+	Reload() error
+}
+
+type reloadable struct {
+	name string
+	path string
+	r    reloader
+	// watch, if set, starts watchers in background instead of polling path
+	watch func(ctx context.Context, interval time.Duration, onChange func())
+}
+
+// reloadFiles reloads the files on SIGHUP, and on file change if interval > 0.
+// It blocks until ctx is done.
+func reloadFiles(ctx context.Context, interval time.Duration, files ...reloadable) {
+	// serialize reloads from signal and watchers
+	var mu sync.Mutex
+	reload := func(f reloadable) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := f.r.Reload(); err != nil {
+			slog.ErrorContext(ctx, "Reload failed, keeping previous state", "name", f.name, "file", f.path, "error", err)
+		}
+	}
+
+	if interval > 0 {
+		for _, f := range files {
+			onChange := func() {
+				slog.InfoContext(ctx, "File changed, reloading", "name", f.name, "file", f.path)
+				reload(f)
+			}
+
+			switch {
+			case f.watch != nil:
+				f.watch(ctx, interval, onChange)
+			case f.path != "":
+				go fileutil.WatchFile(ctx, f.path, interval, onChange)
+			}
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.InfoContext(ctx, "SIGHUP received, reloading")
+			for _, f := range files {
+				reload(f)
+			}
+		}
+	}
+}
+
+// zoneReloader re-reads the zone list from --zone, --config and --zone-dir.
+type zoneReloader struct {
+	cmd  *ServeCmd
+	zctl zone.Controller
+}
+
+func newZoneReloadable(cmd *ServeCmd, zctl zone.Controller) reloadable {
+	r := &zoneReloader{cmd: cmd, zctl: zctl}
+	ret := reloadable{name: "zones", path: string(cmd.Config), r: r, watch: r.watch}
+	if ret.path == "" {
+		// only for logs
+		ret.path = cmd.ZoneDir
+	}
+
+	return ret
+}
+
+// watch polls the config file and the zone directory listing.
+func (r *zoneReloader) watch(ctx context.Context, interval time.Duration, onChange func()) {
+	if r.cmd.Config != "" {
+		go fileutil.WatchFile(ctx, string(r.cmd.Config), interval, onChange)
+	}
+	if r.cmd.ZoneDir != "" {
+		go fileutil.WatchDir(ctx, r.cmd.ZoneDir, r.cmd.ZonePattern, interval, onChange)
+	}
+}
+
+func (r *zoneReloader) Reload() error {
+	zones, err := r.cmd.zoneConfigs()
+	if err != nil {
+		return err
+	}
+
+	return r.zctl.Reload(context.Background(), zones...)
+}
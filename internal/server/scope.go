@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-fuego/fuego"
+
+	"github.com/vooon/zoneomatic/internal/htpasswd"
+	"github.com/vooon/zoneomatic/internal/zone"
+)
+
+// newEndpointScopeMiddleware rejects tokens which are not allowed to use the endpoint family.
+// Allowed identities are passed to the zone controller as the actor of changes.
+func newEndpointScopeMiddleware(endpoint string, onForbidden func(http.ResponseWriter, *http.Request, string)) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := htpasswd.IdentityFromContext(r.Context())
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if !id.Scopes.AllowsEndpoint(endpoint) {
+				onForbidden(w, r, fmt.Sprintf("token is not allowed to use %s endpoints", endpoint))
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(zone.WithActor(r.Context(), zoneActor(id))))
+		})
+	}
+}
+
+func zoneActor(id htpasswd.Identity) zone.Actor {
+	return zone.Actor{
+		User:     id.User,
+		Token:    id.Token,
+		Issuer:   id.Issuer,
+		ClientIP: id.ClientIP,
+	}
+}
+
+func sendForbidden(w http.ResponseWriter, r *http.Request, detail string) {
+	fuego.SendError(w, r, forbiddenError(detail))
+}
+
+// checkNameScope returns forbidden error if request identity is not allowed to change the name.
+func checkNameScope(ctx context.Context, name string) error {
+	if msg := nameScopeViolation(ctx, name); msg != "" {
+		return forbiddenError(msg)
+	}
+
+	return nil
+}
+
+func nameScopeViolation(ctx context.Context, name string) string {
+	id, ok := htpasswd.IdentityFromContext(ctx)
+	if !ok || id.Scopes.AllowsName(name) {
+		return ""
+	}
+
+	return "token is not allowed to change " + name
+}
+
+func zoneScopeAllowed(ctx context.Context, zoneName string) bool {
+	id, ok := htpasswd.IdentityFromContext(ctx)
+	return !ok || id.Scopes.AllowsZone(zoneName)
+}
+
+func nameScopeAllowed(ctx context.Context, name string) bool {
+	return nameScopeViolation(ctx, name) == ""
+}
+
+// acmeScopeName returns the name to check for ACME challenge domain.
+func acmeScopeName(domain string) string {
+	return strings.TrimPrefix(domain, "_acme-challenge.")
+}
+
+func forbiddenError(detail string) *fuego.HTTPError {
+	return &fuego.HTTPError{
+		Title:  "forbidden",
+		Detail: detail,
+		Status: http.StatusForbidden,
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -15,7 +16,9 @@ import (
 	"github.com/go-fuego/fuego/param"
 	"github.com/pires/go-proxyproto"
 
+	"github.com/vooon/zoneomatic/internal/audit"
 	"github.com/vooon/zoneomatic/internal/htpasswd"
+	"github.com/vooon/zoneomatic/internal/stats"
 	"github.com/vooon/zoneomatic/internal/zone"
 )
 
@@ -51,7 +54,8 @@ type ZMUpdateResponse struct {
 	Changed bool   `json:"changed"`
 }
 
-func NewServer(cli *Cli) (*fuego.Server, net.Listener, error) {
+// NewServer creates the server and its listener. TLS is terminated if tlsConfig is not nil.
+func NewServer(cli *ServeCmd, tlsConfig *tls.Config) (*fuego.Server, net.Listener, error) {
 
 	listener, err := net.Listen("tcp", cli.Listen)
 	if err != nil {
@@ -66,6 +70,11 @@ func NewServer(cli *Cli) (*fuego.Server, net.Listener, error) {
 		listener = pl
 	}
 
+	if tlsConfig != nil {
+		// PROXY header precedes TLS handshake
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
 	srv := fuego.NewServer(
 		fuego.WithListener(listener),
 		fuego.WithGlobalMiddlewares(otelHTTPMiddleware()),
@@ -118,10 +127,101 @@ func NewServer(cli *Cli) (*fuego.Server, net.Listener, error) {
 	return srv, listener, nil
 }
 
-func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Controller) {
+// Option configures registered endpoints.
+type Option func(*endpointsConfig)
+
+type endpointsConfig struct {
+	authOpts   []htpasswd.MiddlewareOption
+	ddnsPolicy AddressChecker
+	users      htpasswd.UserStore
+	policies   htpasswd.UserPolicies
+	audit      audit.Querier
+
+	readyChecks []readyCheck
+
+	metrics     http.Handler
+	metricsAuth bool
+}
+
+// WithTokens enables API token authentication on all endpoints.
+func WithTokens(ta htpasswd.TokenAuthenticator) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithTokens(ta))
+	}
+}
+
+// WithAuthLimiter limits failed authentication attempts on all endpoints.
+func WithAuthLimiter(l *htpasswd.Limiter) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithLimiter(l))
+	}
+}
+
+// WithJWT enables bearer JWT authentication on all endpoints.
+func WithJWT(ja htpasswd.JWTAuthenticator) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithJWT(ja))
+	}
+}
+
+// WithPolicies applies per-user restrictions on all endpoints.
+func WithPolicies(p htpasswd.UserPolicies) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithPolicies(p))
+		c.policies = p
+	}
+}
 
-	authMw := htpasswd.NewBasicAuthMiddleware(htp)
-	registerPDNSEndpoints(srv, htp, zctl)
+// WithTrustedProxies takes the client address from X-Forwarded-For set by the proxies.
+func WithTrustedProxies(prefixes []netip.Prefix) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithTrustedProxies(prefixes))
+	}
+}
+
+// WithDDNSPolicy rejects DDNS updates with addresses not allowed by the policy.
+func WithDDNSPolicy(ac AddressChecker) Option {
+	return func(c *endpointsConfig) {
+		c.ddnsPolicy = ac
+	}
+}
+
+// WithUserStore enables user management endpoints for users with the admin role.
+func WithUserStore(us htpasswd.UserStore) Option {
+	return func(c *endpointsConfig) {
+		c.users = us
+	}
+}
+
+// WithAuditLog enables the audit query endpoint for users with the admin role.
+func WithAuditLog(q audit.Querier) Option {
+	return func(c *endpointsConfig) {
+		c.audit = q
+	}
+}
+
+// WithClientCerts authenticates verified TLS client certificates, mapping the field to the user.
+func WithClientCerts(field string) Option {
+	return func(c *endpointsConfig) {
+		c.authOpts = append(c.authOpts, htpasswd.WithClientCerts(field))
+	}
+}
+
+func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Controller, opts ...Option) {
+
+	cfg := &endpointsConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	authMw := htpasswd.NewBasicAuthMiddleware(htp, cfg.authOpts...)
+	ddnsScope := newEndpointScopeMiddleware(htpasswd.EndpointDDNS, sendForbidden)
+	acmeScope := newEndpointScopeMiddleware(htpasswd.EndpointACME, sendForbidden)
+	zmScope := newEndpointScopeMiddleware(htpasswd.EndpointZM, sendForbidden)
+	registerPDNSEndpoints(srv, htp, zctl, cfg)
+	registerAdminEndpoints(srv, htp, cfg)
+	registerAuditEndpoint(srv, htp, cfg)
+	registerMetricsEndpoint(srv, htp, cfg)
 
 	fuego.Get(srv, "/health",
 		func(ctx fuego.ContextNoBody) (string, error) {
@@ -130,6 +230,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		option.Summary("health"),
 		option.Description("Health check endpoint"),
 	)
+	registerReadyEndpoint(srv, zctl, cfg)
 
 	fuego.Get(srv, "/myip",
 		func(ctx fuego.ContextNoBody) (string, error) {
@@ -144,6 +245,9 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		option.Description("Return client's connection IP address"),
 	)
 
+	// ddnsBadIP is the dyndns2 style response to an address rejected by the policy
+	const ddnsBadIP = "badip"
+
 	fuego.Get(srv, "/nic/update",
 		func(ctx fuego.ContextNoBody) (string, error) {
 			lg := slog.Default()
@@ -159,6 +263,9 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				return "", badRequestError("missing required query parameter: hostname")
 			}
 			domain := hns[0]
+			if err := checkNameScope(ctx, domain); err != nil {
+				return "", err
+			}
 
 			var err error
 			newAddrs := make([]netip.Addr, 0)
@@ -185,6 +292,18 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				newAddrs = append(newAddrs, a.Addr())
 			}
 
+			if cfg.ddnsPolicy != nil {
+				for _, a := range newAddrs {
+					if err := cfg.ddnsPolicy.Check(domain, a); err != nil {
+						lg.WarnContext(ctx, "DDNS address rejected by policy", "domain", domain, "error", err)
+						// dyndns2 clients look for the status word, the reason stays in the log
+						ctx.SetStatus(http.StatusBadRequest)
+						return ddnsBadIP, nil
+					}
+				}
+			}
+
+			stats.Default.RecordUpdate(ctx, "ddns")
 			err = zctl.UpdateDDNSAddress(ctx, domain, newAddrs)
 			if err != nil {
 				return "", zoneErrorToHTTPError(err)
@@ -194,7 +313,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		},
 		option.Summary("update ddns"),
 		option.Description("Update DDNS record"),
-		option.Middleware(authMw),
+		option.Middleware(authMw, ddnsScope),
 		option.Security(openapi3.SecurityRequirement{
 			"basicAuth": []string{},
 		}),
@@ -217,6 +336,12 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				return
 			}
 
+			if err := checkNameScope(ctx, acmeScopeName(req.Subdomain)); err != nil {
+				fuego.SendError(w, r, err)
+				return
+			}
+
+			stats.Default.RecordUpdate(ctx, "acme")
 			err = zctl.UpdateACMEChallenge(ctx, req.Subdomain, req.TXT, "")
 			if err != nil {
 				fuego.SendError(w, r, zoneErrorToHTTPError(err))
@@ -227,7 +352,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		},
 		option.Summary("update acme"),
 		option.Description("Update ACME challenge TXT record"),
-		option.Middleware(authMw),
+		option.Middleware(authMw, acmeScope),
 		option.Security(
 			openapi3.SecurityRequirement{
 				"apiUserAuth": []string{},
@@ -264,6 +389,12 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				return
 			}
 
+			if err := checkNameScope(ctx, acmeScopeName(req.Fqdn)); err != nil {
+				fuego.SendError(w, r, err)
+				return
+			}
+
+			stats.Default.RecordUpdate(ctx, "lego-present")
 			err = zctl.UpdateACMEChallenge(ctx, req.Fqdn, req.Value, zone.EmptyPlaceholder)
 			if err != nil {
 				fuego.SendError(w, r, zoneErrorToHTTPError(err))
@@ -274,7 +405,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		},
 		option.Summary("update acme via lego httpreq"),
 		option.Description("Update ACME challenge TXT record using LEGO HTTP-REQ"),
-		option.Middleware(authMw),
+		option.Middleware(authMw, acmeScope),
 		option.Security(
 			openapi3.SecurityRequirement{
 				"basicAuth": []string{},
@@ -306,7 +437,13 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				return
 			}
 
+			if err := checkNameScope(ctx, acmeScopeName(req.Fqdn)); err != nil {
+				fuego.SendError(w, r, err)
+				return
+			}
+
 			// NOTE: lego sends which txt value to remove, but i do not support multiple ACME TXTs anyway
+			stats.Default.RecordUpdate(ctx, "lego-cleanup")
 			err = zctl.UpdateACMEChallenge(ctx, req.Fqdn, "", req.Value)
 			if err != nil {
 				fuego.SendError(w, r, zoneErrorToHTTPError(err))
@@ -317,7 +454,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		},
 		option.Summary("cleanup acme via lego httpreq"),
 		option.Description("Clean up ACME challenge TXT record using LEGO HTTP-REQ"),
-		option.Middleware(authMw),
+		option.Middleware(authMw, acmeScope),
 		option.Security(
 			openapi3.SecurityRequirement{
 				"basicAuth": []string{},
@@ -343,6 +480,11 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 				return nil, err
 			}
 
+			if err := checkNameScope(ctx, req.Fqdn); err != nil {
+				return nil, err
+			}
+
+			stats.Default.RecordUpdate(ctx, "zm")
 			changed, err := zctl.ZMUpdateRecord(ctx, req.Fqdn, req.Type, req.TTL, req.Values)
 			if err != nil {
 				return nil, zoneErrorToHTTPError(err)
@@ -352,7 +494,7 @@ func RegisterEndpoints(srv *fuego.Server, htp htpasswd.HTPasswd, zctl zone.Contr
 		},
 		option.Summary("update any dns record"),
 		option.Description("Replace any existing DNS record value"),
-		option.Middleware(authMw),
+		option.Middleware(authMw, zmScope),
 		option.Security(
 			openapi3.SecurityRequirement{
 				"basicAuth": []string{},
@@ -378,6 +520,27 @@ func zoneErrorToHTTPError(err error) error {
 			Status: http.StatusNotFound,
 		}
 	}
+	if errors.Is(err, zone.ErrOperationNotAllowed) {
+		return &fuego.HTTPError{
+			Title:  "operation not allowed",
+			Detail: err.Error(),
+			Status: http.StatusForbidden,
+		}
+	}
+	if errors.Is(err, zone.ErrZoneLocked) {
+		return &fuego.HTTPError{
+			Title:  "zone locked",
+			Detail: err.Error(),
+			Status: http.StatusServiceUnavailable,
+		}
+	}
+	if errors.Is(err, zone.ErrZoneConflict) {
+		return &fuego.HTTPError{
+			Title:  "zone conflict",
+			Detail: err.Error(),
+			Status: http.StatusConflict,
+		}
+	}
 
 	return err
 }
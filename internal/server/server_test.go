@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
@@ -13,17 +14,25 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"testing/synctest"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/go-fuego/fuego"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/vooon/zoneomatic/internal/audit"
+	"github.com/vooon/zoneomatic/internal/htpasswd"
+	"github.com/vooon/zoneomatic/internal/stats"
 	"github.com/vooon/zoneomatic/internal/zone"
 )
 
 type fakeHTPasswd struct {
 	user string
 	pass string
+	// owners are users without password, e.g. owning tokens
+	owners []string
 }
 
 func (f fakeHTPasswd) Authenticate(user, password string) (ok, present bool) {
@@ -33,12 +42,17 @@ func (f fakeHTPasswd) Authenticate(user, password string) (ok, present bool) {
 	return password == f.pass, true
 }
 
+func (f fakeHTPasswd) HasUser(user string) bool {
+	return user == f.user || slices.Contains(f.owners, user)
+}
+
 type fakeRRSetReplaceCall struct {
 	zoneName string
 	name     string
 	typ      string
 	ttl      int
 	values   []string
+	disabled []string
 }
 
 type fakeRRSetDeleteCall struct {
@@ -50,13 +64,17 @@ type fakeRRSetDeleteCall struct {
 type fakeZoneController struct {
 	lastDomain string
 	lastAddrs  []netip.Addr
+	lastActor  zone.Actor
 	ddnsErr    error
 	zones      map[string]zone.ZoneSnapshot
 	getZoneErr error
 	replaceErr error
 	deleteErr  error
+	patchErr   error
 	replaced   []fakeRRSetReplaceCall
 	deleted    []fakeRRSetDeleteCall
+	patched    []zone.RRSetChange
+	status     []zone.ZoneStatus
 }
 
 func (f *fakeZoneController) ListZones(_ context.Context) ([]zone.ZoneSnapshot, error) {
@@ -80,10 +98,11 @@ func (f *fakeZoneController) GetZone(_ context.Context, zoneName string) (zone.Z
 	return zone.ZoneSnapshot{}, fmt.Errorf("wrapped: %w", zone.ErrZoneNotFound)
 }
 
-func (f *fakeZoneController) UpdateDDNSAddress(_ context.Context, domain string, addrs []netip.Addr) error {
+func (f *fakeZoneController) UpdateDDNSAddress(ctx context.Context, domain string, addrs []netip.Addr) error {
 	if f.ddnsErr != nil {
 		return f.ddnsErr
 	}
+	f.lastActor, _ = zone.ActorFromContext(ctx)
 	f.lastDomain = domain
 	f.lastAddrs = addrs
 	return nil
@@ -93,7 +112,7 @@ func (f *fakeZoneController) UpdateACMEChallenge(_ context.Context, _ string, _,
 	return nil
 }
 
-func (f *fakeZoneController) ReplaceRRSet(_ context.Context, zoneName, name, typ string, ttl int, values []string) (changed bool, err error) {
+func (f *fakeZoneController) ReplaceRRSet(_ context.Context, zoneName, name, typ string, ttl int, values, disabled []string) (changed bool, err error) {
 	if f.replaceErr != nil {
 		return false, f.replaceErr
 	}
@@ -104,6 +123,7 @@ func (f *fakeZoneController) ReplaceRRSet(_ context.Context, zoneName, name, typ
 		typ:      typ,
 		ttl:      ttl,
 		values:   append([]string(nil), values...),
+		disabled: append([]string(nil), disabled...),
 	})
 
 	return true, nil
@@ -123,11 +143,42 @@ func (f *fakeZoneController) DeleteRRSet(_ context.Context, zoneName, name, typ
 	return true, nil
 }
 
+func (f *fakeZoneController) PatchRRSets(ctx context.Context, zoneName string, changes []zone.RRSetChange) (changed bool, err error) {
+	if f.patchErr != nil {
+		return false, f.patchErr
+	}
+
+	f.patched = append(f.patched, changes...)
+
+	for _, ch := range changes {
+		var err error
+		switch ch.ChangeType {
+		case zone.ChangeReplace:
+			_, err = f.ReplaceRRSet(ctx, zoneName, ch.Name, ch.Type, ch.TTL, ch.Records, ch.Disabled)
+		case zone.ChangeDelete:
+			_, err = f.DeleteRRSet(ctx, zoneName, ch.Name, ch.Type)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return len(changes) > 0, nil
+}
+
 func (f *fakeZoneController) ZMUpdateRecord(_ context.Context, _ string, _ string, _ int, _ []string) (changed bool, err error) {
 	return false, nil
 }
 
-func newTestServer(htp fakeHTPasswd, zctl *fakeZoneController) *fuego.Server {
+func (f *fakeZoneController) CheckZones(_ context.Context) []zone.ZoneStatus {
+	return f.status
+}
+
+func (f *fakeZoneController) Reload(_ context.Context, _ ...zone.FileConfig) error {
+	return nil
+}
+
+func newTestServer(htp htpasswd.HTPasswd, zctl *fakeZoneController, opts ...Option) *fuego.Server {
 	srv := fuego.NewServer(
 		fuego.WithSecurity(
 			map[string]*openapi3.SecuritySchemeRef{
@@ -157,7 +208,7 @@ func newTestServer(htp fakeHTPasswd, zctl *fakeZoneController) *fuego.Server {
 			},
 		),
 	)
-	RegisterEndpoints(srv, htp, zctl)
+	RegisterEndpoints(srv, htp, zctl, opts...)
 	return srv
 }
 
@@ -245,6 +296,36 @@ func TestNICUpdate_ZoneNotFoundMappedTo404(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestNICUpdate_OperationNotAllowedMappedTo403(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{
+		ddnsErr: fmt.Errorf("%w: example.com.: ddns", zone.ErrOperationNotAllowed),
+	}
+	srv := newTestServer(htp, zctl)
+
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+	req.SetBasicAuth("u", "p")
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestNICUpdate_ZoneConflictMappedTo409(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{
+		ddnsErr: fmt.Errorf("%w: example.com.zone", zone.ErrZoneConflict),
+	}
+	srv := newTestServer(htp, zctl)
+
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+	req.SetBasicAuth("u", "p")
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
 func TestPDNSServerDiscovery(t *testing.T) {
 	htp := fakeHTPasswd{user: "u", pass: "p"}
 	zctl := &fakeZoneController{}
@@ -307,6 +388,77 @@ func TestPDNSZoneGet(t *testing.T) {
 	assert.Len(t, rrsets, 1)
 }
 
+func TestPDNSZoneGetETag(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{
+		zones: map[string]zone.ZoneSnapshot{
+			"example.com.": {ID: "example.com.", Name: "example.com.", Serial: 123, Version: "abc"},
+		},
+	}
+	srv := newTestServer(htp, zctl)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/zones/example.com.", nil)
+		req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"abc"`, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Body.String(), `"serial":123`)
+
+	for _, ifNoneMatch := range []string{`"abc"`, `"old", W/"abc"`, `*`} {
+		rec = get(ifNoneMatch)
+		assert.Equal(t, http.StatusNotModified, rec.Code, ifNoneMatch)
+		assert.Equal(t, `"abc"`, rec.Header().Get("ETag"))
+		assert.Empty(t, rec.Body.String())
+	}
+
+	rec = get(`"old"`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestPDNSPatchZoneIfMatch(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	srv := newTestServer(htp, zctl)
+
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		patchBody := `{"rrsets":[{"name":"www.example.com.","type":"A","changetype":"DELETE","records":[]}]}`
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.", strings.NewReader(patchBody))
+		req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, patch(`*`).Code)
+	assert.Equal(t, http.StatusNoContent, patch(`"abc"`).Code)
+	assert.Len(t, zctl.deleted, 2)
+
+	// weak ETags never match If-Match
+	rec := patch(`W/"abc"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Len(t, zctl.deleted, 2)
+
+	zctl.patchErr = fmt.Errorf("%w: def", zone.ErrVersionMismatch)
+	rec = patch(`"abc"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.JSONEq(t, `{"error":"zone version does not match: def"}`, rec.Body.String())
+}
+
+func TestETagVersions(t *testing.T) {
+	assert.Equal(t, []string{"abc", "def"}, etagVersions(` "abc",W/"xyz" , "def", bad`))
+	assert.Empty(t, etagVersions(`W/"abc"`))
+}
+
 func TestPDNSPatchZoneReplaceAndDelete(t *testing.T) {
 	htp := fakeHTPasswd{user: "u", pass: "p"}
 	zctl := &fakeZoneController{}
@@ -335,6 +487,220 @@ func TestPDNSPatchZoneReplaceAndDelete(t *testing.T) {
 	}, zctl.deleted[0])
 }
 
+func TestPDNSPatchZoneExtendAndPrune(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	srv := newTestServer(htp, zctl)
+
+	patchBody := `{"rrsets":[{"name":"www.example.com.","type":"A","ttl":60,"changetype":"EXTEND","records":[{"content":"1.2.3.4","disabled":false}]},{"name":"www.example.com.","type":"A","changetype":"prune","records":[{"content":"5.6.7.8","disabled":false}]}]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.", strings.NewReader(patchBody))
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []zone.RRSetChange{
+		{ChangeType: zone.ChangeExtend, Name: "www.example.com.", Type: "A", TTL: 60, Records: []string{"1.2.3.4"}},
+		{ChangeType: zone.ChangePrune, Name: "www.example.com.", Type: "A", Records: []string{"5.6.7.8"}},
+	}, zctl.patched)
+
+	// invalid change rejects the whole batch
+	zctl.patched = nil
+	patchBody = `{"rrsets":[{"name":"www.example.com.","type":"A","changetype":"DELETE","records":[]},{"name":"www.example.com.","type":"A","changetype":"PRUNE","records":[]}]}`
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.", strings.NewReader(patchBody))
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec = httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Empty(t, zctl.patched)
+	assert.Empty(t, zctl.deleted)
+}
+
+func TestPDNSPatchZoneDisabledRecords(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	srv := newTestServer(htp, zctl)
+
+	patchBody := `{"rrsets":[{"name":"www.example.com.","type":"A","ttl":60,"changetype":"REPLACE","records":[{"content":"1.2.3.4","disabled":false},{"content":"5.6.7.8","disabled":true}]}]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.", strings.NewReader(patchBody))
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []fakeRRSetReplaceCall{{
+		zoneName: "example.com.",
+		name:     "www.example.com.",
+		typ:      "A",
+		ttl:      60,
+		values:   []string{"1.2.3.4"},
+		disabled: []string{"5.6.7.8"},
+	}}, zctl.replaced)
+}
+
+func TestPDNSZoneGetDisabledRecords(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{
+		zones: map[string]zone.ZoneSnapshot{
+			"example.com.": {
+				ID:   "example.com.",
+				Name: "example.com.",
+				RRsets: []zone.RRSet{{
+					Name:            "www.example.com.",
+					Type:            "A",
+					TTL:             60,
+					Records:         []string{"1.2.3.4"},
+					DisabledRecords: []string{"5.6.7.8"},
+				}},
+			},
+		},
+	}
+	srv := newTestServer(htp, zctl)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/zones/example.com.", nil)
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body pdnsZone
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	if assert.Len(t, body.RRsets, 1) {
+		assert.Equal(t, []pdnsRecord{
+			{Content: "1.2.3.4", Disabled: false},
+			{Content: "5.6.7.8", Disabled: true},
+		}, body.RRsets[0].Records)
+	}
+}
+
+func TestPDNSStatistics(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	srv := newTestServer(htp, zctl)
+
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+	req.SetBasicAuth("u", "p")
+	srv.Mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/statistics", nil)
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var items []map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+
+	byName := make(map[string]map[string]any, len(items))
+	for _, it := range items {
+		byName[it["name"].(string)] = it
+	}
+	assert.Equal(t, "StatisticItem", byName["zm-auth-failures"]["type"])
+	assert.Equal(t, "MapStatisticItem", byName["zm-updates"]["type"])
+	updates, _ := byName["zm-updates"]["value"].([]any)
+	assert.True(t, slices.ContainsFunc(updates, func(v any) bool {
+		it, _ := v.(map[string]any)
+		return it["name"] == "ddns"
+	}))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/statistics?statistic=zm-zones", nil)
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec = httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "zm-zones", items[0]["name"])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/statistics?statistic=nope", nil)
+	req.Header.Set("X-API-Key", testPDNSAPIKey("u", "p"))
+	rec = httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestTokenScopes(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{
+		zones: map[string]zone.ZoneSnapshot{
+			"example.com.": {
+				ID:   "example.com.",
+				Name: "example.com.",
+				RRsets: []zone.RRSet{
+					{Name: "home.example.com.", Type: "A", TTL: 60, Records: []string{"1.2.3.4"}},
+					{Name: "www.example.com.", Type: "A", TTL: 60, Records: []string{"5.6.7.8"}},
+				},
+			},
+		},
+	}
+
+	tokens, err := htpasswd.NewTokensFromFile(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	ddnsSecret, _, err := tokens.Create("router", "u", time.Time{}, htpasswd.Scopes{
+		Endpoints: []string{htpasswd.EndpointDDNS},
+		Names:     []string{"home.example.com."},
+	})
+	require.NoError(t, err)
+	pdnsSecret, _, err := tokens.Create("proxmox", "u", time.Time{}, htpasswd.Scopes{
+		Endpoints: []string{htpasswd.EndpointPDNS},
+		Names:     []string{"home.example.com."},
+	})
+	require.NoError(t, err)
+
+	srv := newTestServer(htp, zctl, WithTokens(tokens))
+
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{"bearer", http.MethodGet, "/nic/update?hostname=home.example.com&myip=1.2.3.4", "", "Authorization", "Bearer " + ddnsSecret, http.StatusOK},
+		{"api-key", http.MethodGet, "/nic/update?hostname=home.example.com&myip=1.2.3.4", "", "X-Api-Key", ddnsSecret, http.StatusOK},
+		{"bad-bearer", http.MethodGet, "/nic/update?hostname=home.example.com&myip=1.2.3.4", "", "Authorization", "Bearer zmt_0000_bad", http.StatusUnauthorized},
+		{"name-forbidden", http.MethodGet, "/nic/update?hostname=www.example.com&myip=1.2.3.4", "", "Authorization", "Bearer " + ddnsSecret, http.StatusForbidden},
+		{"endpoint-forbidden", http.MethodGet, "/nic/update?hostname=home.example.com&myip=1.2.3.4", "", "Authorization", "Bearer " + pdnsSecret, http.StatusForbidden},
+		{"pdns-endpoint-forbidden", http.MethodGet, "/api/v1/servers/localhost/zones", "", "X-API-Key", ddnsSecret, http.StatusForbidden},
+		{"pdns-patch-allowed", http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.",
+			`{"rrsets":[{"name":"home.example.com.","type":"A","ttl":60,"changetype":"REPLACE","records":[{"content":"1.2.3.4"}]}]}`,
+			"X-API-Key", pdnsSecret, http.StatusNoContent},
+		{"pdns-patch-forbidden", http.MethodPatch, "/api/v1/servers/localhost/zones/example.com.",
+			`{"rrsets":[{"name":"www.example.com.","type":"A","ttl":60,"changetype":"REPLACE","records":[{"content":"1.2.3.4"}]}]}`,
+			"X-API-Key", pdnsSecret, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			srv.Mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.wantCode, rec.Code, rec.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/servers/localhost/zones/example.com.", nil)
+	req.Header.Set("Authorization", "Bearer "+pdnsSecret)
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body pdnsZone
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.RRsets, 1)
+	assert.Equal(t, "home.example.com.", body.RRsets[0].Name)
+}
+
 func TestPDNSUnauthorized(t *testing.T) {
 	htp := fakeHTPasswd{user: "u", pass: "p"}
 	zctl := &fakeZoneController{}
@@ -388,7 +754,7 @@ func TestPDNSOpenAPIHasStableMetadata(t *testing.T) {
 func TestOpenAPISpecFormattingAndDescription(t *testing.T) {
 	htp := fakeHTPasswd{user: "u", pass: "p"}
 	zctl := &fakeZoneController{}
-	srv, _, err := NewServer(&Cli{Listen: "127.0.0.1:0"})
+	srv, _, err := NewServer(&ServeCmd{Listen: "127.0.0.1:0"}, nil)
 	assert.NoError(t, err)
 	srv.OpenAPI.Config.JSONFilePath = filepath.Join(t.TempDir(), "openapi.json")
 	RegisterEndpoints(srv, htp, zctl)
@@ -415,3 +781,392 @@ func TestOpenAPISpecFormattingAndDescription(t *testing.T) {
 func testPDNSAPIKey(user, password string) string {
 	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
 }
+
+func TestAuthLimiter(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	limiter := htpasswd.NewLimiter(htpasswd.LimiterConfig{Burst: 1, Refill: time.Minute, Lockout: time.Minute})
+	srv := newTestServer(htp, zctl, WithAuthLimiter(limiter))
+
+	do := func(user, pass string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth(user, pass)
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("u", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("u", "wrong").Code)
+
+	before := stats.Default.Snapshot().AuthBlocked
+	rec := do("u", "p")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, before+1, stats.Default.Snapshot().AuthBlocked)
+}
+
+type fakeJWT map[string]htpasswd.Identity
+
+func (f fakeJWT) AuthenticateJWT(token string) (htpasswd.Identity, bool) {
+	id, ok := f[token]
+	return id, ok
+}
+
+func TestJWTBearer(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	jwts := fakeJWT{
+		"h.ci.s": {User: "infra/dns", Issuer: "https://ci.example.com", Scopes: htpasswd.Scopes{Names: []string{"home.example.com."}}},
+	}
+	srv := newTestServer(htp, zctl, WithJWT(jwts))
+
+	testCases := []struct {
+		name     string
+		bearer   string
+		hostname string
+		expected int
+	}{
+		{"ok", "h.ci.s", "home.example.com", http.StatusOK},
+		{"name-forbidden", "h.ci.s", "www.example.com", http.StatusForbidden},
+		{"unknown", "h.other.s", "home.example.com", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname="+tc.hostname+"&myip=1.2.3.4", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			rec := httptest.NewRecorder()
+			srv.Mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+
+	assert.Equal(t, "infra/dns", zctl.lastActor.User)
+	assert.Equal(t, "https://ci.example.com", zctl.lastActor.Issuer)
+	assert.True(t, zctl.lastActor.ClientIP.IsValid())
+}
+
+type fakePolicies map[string]htpasswd.UserPolicy
+
+func (f fakePolicies) UserPolicy(user string) htpasswd.UserPolicy {
+	return f[user]
+}
+
+func TestSourceRestrictions(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p", owners: []string{"other"}}
+	zctl := &fakeZoneController{}
+
+	tokens, err := htpasswd.NewTokensFromFile(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	secret, _, err := tokens.Create("router", "other", time.Time{}, htpasswd.Scopes{
+		Sources: []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")},
+	})
+	require.NoError(t, err)
+
+	srv := newTestServer(htp, zctl,
+		WithTokens(tokens),
+		WithPolicies(fakePolicies{"u": {Sources: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}}),
+		WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}),
+	)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		bearer     string
+		expected   int
+	}{
+		{"user-allowed", "192.0.2.1:1234", "", "", http.StatusOK},
+		{"user-denied", "198.51.100.1:1234", "", "", http.StatusUnauthorized},
+		{"user-spoofed-forwarded", "198.51.100.1:1234", "192.0.2.1", "", http.StatusUnauthorized},
+		{"user-trusted-proxy", "10.0.0.1:1234", "192.0.2.1", "", http.StatusOK},
+		{"token-allowed", "198.51.100.1:1234", "", secret, http.StatusOK},
+		{"token-denied", "192.0.2.1:1234", "", secret, http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			} else {
+				req.SetBasicAuth("u", "p")
+			}
+			rec := httptest.NewRecorder()
+			srv.Mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+}
+
+func TestNICUpdate_DDNSPolicy(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	srv := newTestServer(htp, zctl, WithDDNSPolicy(&DDNSPolicy{Default: AddressPolicy{Deny: []string{AddrPrivate, AddrCGNAT}}}))
+
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=100.64.1.2", nil)
+	req.SetBasicAuth("u", "p")
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "badip", rec.Body.String())
+	assert.Empty(t, zctl.lastAddrs)
+}
+
+type fakeUserStore map[string]string
+
+func (f fakeUserStore) Users() []string {
+	return slices.Sorted(maps.Keys(f))
+}
+
+func (f fakeUserStore) AddUser(user, password string) error {
+	if _, ok := f[user]; ok {
+		return htpasswd.ErrUserExists
+	}
+	f[user] = password
+	return nil
+}
+
+func (f fakeUserStore) SetPassword(user, password string) error {
+	if _, ok := f[user]; !ok {
+		return htpasswd.ErrUserNotFound
+	}
+	f[user] = password
+	return nil
+}
+
+func (f fakeUserStore) DeleteUser(user string) error {
+	if _, ok := f[user]; !ok {
+		return htpasswd.ErrUserNotFound
+	}
+	delete(f, user)
+	return nil
+}
+
+func TestAdminUsers(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	zctl := &fakeZoneController{}
+	users := fakeUserStore{"u": "p", "router": "x"}
+
+	tokens, err := htpasswd.NewTokensFromFile(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	ddnsSecret, _, err := tokens.Create("ddns", "u", time.Time{}, htpasswd.Scopes{})
+	require.NoError(t, err)
+	adminSecret, _, err := tokens.Create("admin", "u", time.Time{}, htpasswd.Scopes{Endpoints: []string{htpasswd.EndpointAdmin}})
+	require.NoError(t, err)
+
+	srv := newTestServer(htp, zctl,
+		WithTokens(tokens),
+		WithUserStore(users),
+		WithPolicies(fakePolicies{"u": {Roles: []string{htpasswd.RoleAdmin}}}),
+	)
+
+	do := func(method, url, body, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		} else {
+			req.SetBasicAuth("u", "p")
+		}
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/admin/users", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"user":"router"},{"user":"u"}]`, rec.Body.String())
+
+	rec = do(http.MethodPost, "/admin/users", `{"user":"alice"}`, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created AdminUserResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "alice", created.User)
+	assert.Len(t, created.Password, 32)
+	assert.Equal(t, created.Password, users["alice"])
+
+	rec = do(http.MethodPost, "/admin/users", `{"user":"alice","password":"x"}`, "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(http.MethodPut, "/admin/users/alice/password", `{"password":"supplied"}`, adminSecret)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"user":"alice"}`, rec.Body.String())
+	assert.Equal(t, "supplied", users["alice"])
+
+	rec = do(http.MethodDelete, "/admin/users/alice", "", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(http.MethodDelete, "/admin/users/alice", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// token without admin scope
+	rec = do(http.MethodGet, "/admin/users", "", ddnsSecret)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAdminUsers_DeleteRevokesTokens(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.htpasswd")
+	require.NoError(t, os.WriteFile(filename, []byte("admin:admin\nalice:alice\n"), 0600))
+	users, err := htpasswd.NewFromFile(filename, htpasswd.WithInsecureHashes(true))
+	require.NoError(t, err)
+
+	tokens, err := htpasswd.NewTokensFromFile(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	secret, _, err := tokens.Create("router", "alice", time.Time{}, htpasswd.Scopes{})
+	require.NoError(t, err)
+
+	srv := newTestServer(users, &fakeZoneController{},
+		WithTokens(tokens),
+		WithUserStore(users),
+		WithPolicies(fakePolicies{"admin": {Roles: []string{htpasswd.RoleAdmin}}}),
+	)
+
+	update := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, update())
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/users/alice", nil)
+	req.SetBasicAuth("admin", "admin")
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, update())
+}
+
+func TestAdminUsers_RoleRequired(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	srv := newTestServer(htp, &fakeZoneController{}, WithUserStore(fakeUserStore{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	req.SetBasicAuth("u", "p")
+	rec := httptest.NewRecorder()
+	srv.Mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+type fakeAuditQuerier []audit.Entry
+
+func (q fakeAuditQuerier) Find(name, typ string, limit int) ([]audit.Entry, error) {
+	ret := make([]audit.Entry, 0)
+	for _, e := range q {
+		if e.Name == name && (typ == "" || e.Type == typ) && len(ret) < limit {
+			ret = append(ret, e)
+		}
+	}
+
+	return ret, nil
+}
+
+func TestAuditEndpoint(t *testing.T) {
+	htp := fakeHTPasswd{user: "u", pass: "p"}
+	q := fakeAuditQuerier{
+		{Name: "a.example.com.", Type: "A", User: "router", New: []string{"192.0.2.2"}, NewSerial: 3},
+		{Name: "a.example.com.", Type: "A", User: "router", New: []string{"192.0.2.1"}, NewSerial: 2},
+	}
+	srv := newTestServer(htp, &fakeZoneController{},
+		WithAuditLog(q),
+		WithPolicies(fakePolicies{"u": {Roles: []string{htpasswd.RoleAdmin}}}),
+	)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.SetBasicAuth("u", "p")
+		rec := httptest.NewRecorder()
+		srv.Mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/admin/audit?name=a.example.com.&type=A")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var entries []audit.Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint32(3), entries[0].NewSerial)
+	assert.Equal(t, "router", entries[0].User)
+
+	rec = get("/admin/audit?name=a.example.com.&limit=5")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/audit").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/audit?name=a.example.com.&limit=0").Code)
+
+	// admin role required
+	srv = newTestServer(htp, &fakeZoneController{}, WithAuditLog(q))
+	assert.Equal(t, http.StatusForbidden, get("/admin/audit?name=a.example.com.").Code)
+}
+
+func TestReadyEndpoint(t *testing.T) {
+	// NOTE: use synctest to pass the cache TTL without waiting
+	synctest.Test(t, func(t *testing.T) {
+		htp := fakeHTPasswd{user: "u", pass: "p"}
+		zctl := &fakeZoneController{status: []zone.ZoneStatus{
+			{Name: "example.com.", File: "example.com.zone"},
+		}}
+		var checkErr error
+		srv := newTestServer(htp, zctl, WithReadyCheck("htpasswd", func(context.Context) error { return checkErr }))
+
+		get := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.Mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			return rec
+		}
+
+		rec := get()
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"ok",
+			"zones":[{"name":"example.com.","status":"ok"}],
+			"checks":[{"name":"htpasswd","status":"ok"}]}`, rec.Body.String())
+
+		// the result is cached
+		zctl.status = append(zctl.status, zone.ZoneStatus{Name: "example.org.", File: "example.org.zone", Err: zone.ErrSoaNotFound})
+		rec = get()
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		time.Sleep(readyCacheTTL)
+		rec = get()
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.JSONEq(t, `{"status":"fail",
+			"zones":[
+				{"name":"example.com.","status":"ok"},
+				{"name":"example.org.","status":"fail"}
+			],
+			"checks":[{"name":"htpasswd","status":"ok"}]}`, rec.Body.String())
+
+		// errors may include file paths, they are only logged
+		zctl.status = zctl.status[:1]
+		checkErr = &os.PathError{Op: "open", Path: "/etc/zoneomatic/htpasswd", Err: os.ErrNotExist}
+		time.Sleep(readyCacheTTL)
+		rec = get()
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.JSONEq(t, `{"status":"fail",
+			"zones":[{"name":"example.com.","status":"ok"}],
+			"checks":[{"name":"htpasswd","status":"fail"}]}`, rec.Body.String())
+	})
+}
+
+func TestFileReadable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	assert.ErrorIs(t, fileReadable(path)(ctx), os.ErrNotExist)
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	assert.NoError(t, fileReadable(path)(ctx))
+}
@@ -6,16 +6,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"net/url"
 	"strings"
 
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
@@ -25,14 +21,23 @@ import (
 )
 
 type OTelConfig struct {
-	Endpoint        string            `name:"endpoint" placeholder:"URL" help:"Shared OTLP/HTTP endpoint URL for enabled signals (typically collector URL)"`
-	Headers         map[string]string `name:"header" help:"Additional HTTP headers for all OTLP exporters, repeatable (e.g. Authorization=Bearer token)"`
+	Endpoint        string            `name:"endpoint" placeholder:"URL" help:"Shared OTLP endpoint URL for enabled signals (typically collector URL)"`
+	Protocol        string            `name:"protocol" enum:"http/protobuf,grpc,stdout" default:"http/protobuf" env:"ZM_OTEL_PROTOCOL,OTEL_EXPORTER_OTLP_PROTOCOL" help:"Exporter protocol for enabled signals (http/protobuf|grpc|stdout); stdout prints to stderr"`
+	Headers         map[string]string `name:"header" help:"Additional headers for all OTLP exporters, repeatable (e.g. Authorization=Bearer token)"`
+	Insecure        bool              `name:"insecure" env:"ZM_OTEL_INSECURE,OTEL_EXPORTER_OTLP_INSECURE" help:"Disable TLS of OTLP exporters"`
+	CACert          string            `name:"ca-cert" type:"existingfile" placeholder:"FILE" env:"ZM_OTEL_CA_CERT,OTEL_EXPORTER_OTLP_CERTIFICATE" help:"CA bundle (PEM) to verify the OTLP endpoint"`
+	ClientCert      string            `name:"client-cert" type:"existingfile" placeholder:"FILE" env:"ZM_OTEL_CLIENT_CERT,OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE" help:"Client certificate (PEM) for the OTLP endpoint"`
+	ClientKey       string            `name:"client-key" type:"existingfile" placeholder:"FILE" env:"ZM_OTEL_CLIENT_KEY,OTEL_EXPORTER_OTLP_CLIENT_KEY" help:"Client certificate private key (PEM)"`
 	TracesEnabled   bool              `name:"enable-traces" help:"Enable OpenTelemetry traces signal"`
-	TracesEndpoint  string            `name:"traces-endpoint" placeholder:"URL" help:"OTLP/HTTP traces endpoint URL (e.g. http://127.0.0.1:4318/v1/traces)"`
+	TracesEndpoint  string            `name:"traces-endpoint" placeholder:"URL" help:"OTLP traces endpoint URL (e.g. http://127.0.0.1:4318/v1/traces)"`
+	TracesProtocol  string            `name:"traces-protocol" enum:"http/protobuf,grpc,stdout," default:"" env:"ZM_OTEL_TRACES_PROTOCOL,OTEL_EXPORTER_OTLP_TRACES_PROTOCOL" help:"Traces exporter protocol; defaults to --otel-protocol"`
+	TracesSampler   float64           `name:"traces-sampler-ratio" default:"1" help:"Ratio of sampled root traces, 0..1; child spans follow the parent"`
 	MetricsEnabled  bool              `name:"enable-metrics" help:"Enable OpenTelemetry metrics signal"`
-	MetricsEndpoint string            `name:"metrics-endpoint" placeholder:"URL" help:"OTLP/HTTP metrics endpoint URL (e.g. http://127.0.0.1:4318/v1/metrics)"`
+	MetricsEndpoint string            `name:"metrics-endpoint" placeholder:"URL" help:"OTLP metrics endpoint URL (e.g. http://127.0.0.1:4318/v1/metrics)"`
+	MetricsProtocol string            `name:"metrics-protocol" enum:"http/protobuf,grpc,stdout," default:"" env:"ZM_OTEL_METRICS_PROTOCOL,OTEL_EXPORTER_OTLP_METRICS_PROTOCOL" help:"Metrics exporter protocol; defaults to --otel-protocol"`
 	LogsEnabled     bool              `name:"enable-logs" help:"Enable OpenTelemetry logs signal"`
-	LogsEndpoint    string            `name:"logs-endpoint" placeholder:"URL" help:"OTLP/HTTP logs endpoint URL (e.g. http://127.0.0.1:4318/v1/logs)"`
+	LogsEndpoint    string            `name:"logs-endpoint" placeholder:"URL" help:"OTLP logs endpoint URL (e.g. http://127.0.0.1:4318/v1/logs)"`
+	LogsProtocol    string            `name:"logs-protocol" enum:"http/protobuf,grpc,stdout," default:"" env:"ZM_OTEL_LOGS_PROTOCOL,OTEL_EXPORTER_OTLP_LOGS_PROTOCOL" help:"Logs exporter protocol; defaults to --otel-protocol"`
 	LogsLevel       string            `name:"logs-level" help:"Minimum log level forwarded to OTLP (debug|info|warn|error); defaults to same as console" enum:"debug,info,warn,error," default:""`
 	ServiceName     string            `name:"service-name" default:"zoneomatic" help:"OpenTelemetry service name"`
 }
@@ -42,7 +47,9 @@ type telemetryShutdown struct {
 	LogHandler slog.Handler
 }
 
-func setupTelemetry(ctx context.Context, cfg OTelConfig, includeLogSource bool) (telemetryShutdown, error) {
+// setupTelemetry configures enabled OTLP signals. Extra metric readers, like the Prometheus exporter,
+// are added to the MeterProvider even if OTLP metrics are disabled.
+func setupTelemetry(ctx context.Context, cfg OTelConfig, includeLogSource bool, metricReaders ...sdkmetric.Reader) (telemetryShutdown, error) {
 	ret := telemetryShutdown{
 		Shutdown: func(context.Context) error { return nil },
 	}
@@ -73,16 +80,16 @@ func setupTelemetry(ctx context.Context, cfg OTelConfig, includeLogSource bool)
 	shutdownFns := make([]func(context.Context) error, 0, 3)
 
 	if cfg.TracesEnabled {
-		endpoint := signalEndpoint(cfg.TracesEndpoint, cfg.Endpoint)
-		if endpoint == "" {
-			return ret, errors.New("otel traces enabled, but neither --otel-traces-endpoint nor --otel-endpoint is set")
+		if cfg.TracesSampler < 0 || cfg.TracesSampler > 1 {
+			return ret, fmt.Errorf("--otel-traces-sampler-ratio must be within 0..1, got %v", cfg.TracesSampler)
 		}
 
-		traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
-		if len(cfg.Headers) > 0 {
-			traceOpts = append(traceOpts, otlptracehttp.WithHeaders(cfg.Headers))
+		target, err := newExporterTarget(cfg, "traces", cfg.TracesProtocol, cfg.TracesEndpoint)
+		if err != nil {
+			return ret, err
 		}
-		exp, err := otlptracehttp.New(ctx, traceOpts...)
+
+		exp, err := newTraceExporter(ctx, target)
 		if err != nil {
 			return ret, fmt.Errorf("init traces exporter: %w", err)
 		}
@@ -90,56 +97,48 @@ func setupTelemetry(ctx context.Context, cfg OTelConfig, includeLogSource bool)
 		tp := sdktrace.NewTracerProvider(
 			sdktrace.WithBatcher(exp),
 			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracesSampler))),
 		)
 		otel.SetTracerProvider(tp)
 		shutdownFns = append(shutdownFns, tp.Shutdown)
-		slog.Info("OpenTelemetry traces enabled", "endpoint", endpoint, "service_name", serviceName)
+		slog.Info("OpenTelemetry traces enabled", "endpoint", target.endpoint, "protocol", target.protocol,
+			"sampler_ratio", cfg.TracesSampler, "service_name", serviceName)
 	}
 
 	if cfg.MetricsEnabled {
-		endpoint := signalEndpoint(cfg.MetricsEndpoint, cfg.Endpoint)
-		if endpoint == "" {
-			return ret, errors.New("otel metrics enabled, but neither --otel-metrics-endpoint nor --otel-endpoint is set")
+		target, err := newExporterTarget(cfg, "metrics", cfg.MetricsProtocol, cfg.MetricsEndpoint)
+		if err != nil {
+			return ret, err
 		}
 
-		metricsOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(endpoint)}
-		if len(cfg.Headers) > 0 {
-			metricsOpts = append(metricsOpts, otlpmetrichttp.WithHeaders(cfg.Headers))
-		}
-		exp, err := otlpmetrichttp.New(ctx, metricsOpts...)
+		exp, err := newMetricExporter(ctx, target)
 		if err != nil {
 			return ret, fmt.Errorf("init metrics exporter: %w", err)
 		}
 
-		mp := sdkmetric.NewMeterProvider(
-			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp)),
-			sdkmetric.WithResource(res),
-		)
+		metricReaders = append(metricReaders, sdkmetric.NewPeriodicReader(exp))
+		slog.Info("OpenTelemetry metrics enabled", "endpoint", target.endpoint, "protocol", target.protocol,
+			"service_name", serviceName)
+	}
+
+	if len(metricReaders) > 0 {
+		mpOpts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+		for _, r := range metricReaders {
+			mpOpts = append(mpOpts, sdkmetric.WithReader(r))
+		}
+
+		mp := sdkmetric.NewMeterProvider(mpOpts...)
 		otel.SetMeterProvider(mp)
 		shutdownFns = append(shutdownFns, mp.Shutdown)
-		slog.Info("OpenTelemetry metrics enabled", "endpoint", endpoint, "service_name", serviceName)
 	}
 
 	if cfg.LogsEnabled {
-		endpoint := signalEndpoint(cfg.LogsEndpoint, cfg.Endpoint)
-		if endpoint == "" {
-			return ret, errors.New("otel logs enabled, but neither --otel-logs-endpoint nor --otel-endpoint is set")
+		target, err := newExporterTarget(cfg, "logs", cfg.LogsProtocol, cfg.LogsEndpoint)
+		if err != nil {
+			return ret, err
 		}
 
-		// otlploghttp.WithEndpointURL stores the URL path via newSetting(u.Path),
-		// which marks the setting as explicitly set even when the path is empty.
-		// This prevents the fallback defaultPath ("/v1/logs") from being applied,
-		// unlike otlptracehttp/otlpmetrichttp which use cleanPath() internally.
-		// Normalise: append "/v1/logs" when the URL has no meaningful path.
-		logEndpoint := endpoint
-		if parsed, parseErr := url.Parse(endpoint); parseErr == nil && (parsed.Path == "" || parsed.Path == "/") {
-			logEndpoint = strings.TrimSuffix(endpoint, "/") + "/v1/logs"
-		}
-		logOpts := []otlploghttp.Option{otlploghttp.WithEndpointURL(logEndpoint)}
-		if len(cfg.Headers) > 0 {
-			logOpts = append(logOpts, otlploghttp.WithHeaders(cfg.Headers))
-		}
-		exp, err := otlploghttp.New(ctx, logOpts...)
+		exp, err := newLogExporter(ctx, target)
 		if err != nil {
 			return ret, fmt.Errorf("init logs exporter: %w", err)
 		}
@@ -162,7 +161,8 @@ func setupTelemetry(ctx context.Context, cfg OTelConfig, includeLogSource bool)
 		}
 		ret.LogHandler = otelLogH
 
-		slog.Info("OpenTelemetry logs enabled", "endpoint", endpoint, "service_name", serviceName)
+		slog.Info("OpenTelemetry logs enabled", "endpoint", target.endpoint, "protocol", target.protocol,
+			"service_name", serviceName)
 	}
 
 	ret.Shutdown = func(ctx context.Context) error {
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// Exporter protocols, as in OTEL_EXPORTER_OTLP_PROTOCOL, and stdout for debugging
+const (
+	ProtocolHTTP   = "http/protobuf"
+	ProtocolGRPC   = "grpc"
+	ProtocolStdout = "stdout"
+)
+
+// signalProtocol returns the per-signal protocol or the shared one.
+func signalProtocol(specific, common string) string {
+	if specific != "" {
+		return specific
+	}
+	if common != "" {
+		return common
+	}
+
+	return ProtocolHTTP
+}
+
+// exporterTarget is a resolved exporter configuration of one signal.
+type exporterTarget struct {
+	signal   string
+	protocol string
+	endpoint string
+	headers  map[string]string
+	insecure bool
+	tls      *tls.Config
+}
+
+func newExporterTarget(cfg OTelConfig, signal, protocol, endpoint string) (exporterTarget, error) {
+	t := exporterTarget{
+		signal:   signal,
+		protocol: signalProtocol(protocol, cfg.Protocol),
+		endpoint: signalEndpoint(endpoint, cfg.Endpoint),
+		headers:  cfg.Headers,
+		insecure: cfg.Insecure,
+	}
+
+	if t.protocol == ProtocolStdout {
+		return t, nil
+	}
+	if t.endpoint == "" {
+		return t, fmt.Errorf("otel %s enabled, but neither --otel-%s-endpoint nor --otel-endpoint is set", signal, signal)
+	}
+
+	var err error
+	t.tls, err = cfg.tlsConfig()
+	return t, err
+}
+
+// tlsConfig returns TLS settings for exporters, nil to use system roots.
+func (c OTelConfig) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && c.ClientCert == "" {
+		return nil, nil
+	}
+
+	tcfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read otel ca certificate: %w", err)
+		}
+
+		tcfg.RootCAs = x509.NewCertPool()
+		if !tcfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in otel ca file: %s", c.CACert)
+		}
+	}
+
+	if c.ClientCert != "" {
+		if c.ClientKey == "" {
+			return nil, errors.New("--otel-client-key is required with --otel-client-cert")
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load otel client certificate: %w", err)
+		}
+		tcfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tcfg, nil
+}
+
+func newTraceExporter(ctx context.Context, t exporterTarget) (sdktrace.SpanExporter, error) {
+	switch t.protocol {
+	case ProtocolStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+
+	case ProtocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpointURL(t.endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+
+	default:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(t.endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(t.tls))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+}
+
+func newMetricExporter(ctx context.Context, t exporterTarget) (sdkmetric.Exporter, error) {
+	switch t.protocol {
+	case ProtocolStdout:
+		return stdoutmetric.New(stdoutmetric.WithWriter(os.Stderr))
+
+	case ProtocolGRPC:
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpointURL(t.endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+
+	default:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(t.endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(t.tls))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+}
+
+func newLogExporter(ctx context.Context, t exporterTarget) (sdklog.Exporter, error) {
+	switch t.protocol {
+	case ProtocolStdout:
+		return stdoutlog.New(stdoutlog.WithWriter(os.Stderr))
+
+	case ProtocolGRPC:
+		opts := []otlploggrpc.Option{otlploggrpc.WithEndpointURL(t.endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlploggrpc.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlploggrpc.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		return otlploggrpc.New(ctx, opts...)
+
+	default:
+		// otlploghttp.WithEndpointURL stores the URL path via newSetting(u.Path),
+		// which marks the setting as explicitly set even when the path is empty.
+		// This prevents the fallback defaultPath ("/v1/logs") from being applied,
+		// unlike otlptracehttp/otlpmetrichttp which use cleanPath() internally.
+		// Normalise: append "/v1/logs" when the URL has no meaningful path.
+		endpoint := t.endpoint
+		if parsed, parseErr := url.Parse(endpoint); parseErr == nil && (parsed.Path == "" || parsed.Path == "/") {
+			endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/logs"
+		}
+
+		opts := []otlploghttp.Option{otlploghttp.WithEndpointURL(endpoint)}
+		if len(t.headers) > 0 {
+			opts = append(opts, otlploghttp.WithHeaders(t.headers))
+		}
+		if t.insecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		} else if t.tls != nil {
+			opts = append(opts, otlploghttp.WithTLSClientConfig(t.tls))
+		}
+		return otlploghttp.New(ctx, opts...)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalProtocol(t *testing.T) {
+	assert.Equal(t, ProtocolHTTP, signalProtocol("", ""))
+	assert.Equal(t, ProtocolGRPC, signalProtocol("", ProtocolGRPC))
+	assert.Equal(t, ProtocolStdout, signalProtocol(ProtocolStdout, ProtocolGRPC))
+}
+
+func TestNewExporterTarget(t *testing.T) {
+	cfg := OTelConfig{Protocol: ProtocolGRPC}
+
+	_, err := newExporterTarget(cfg, "traces", "", "")
+	assert.ErrorContains(t, err, "--otel-traces-endpoint")
+
+	target, err := newExporterTarget(cfg, "traces", ProtocolStdout, "")
+	require.NoError(t, err)
+	assert.Equal(t, ProtocolStdout, target.protocol)
+
+	cfg.Endpoint = "http://127.0.0.1:4317"
+	target, err = newExporterTarget(cfg, "metrics", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, ProtocolGRPC, target.protocol)
+	assert.Equal(t, "http://127.0.0.1:4317", target.endpoint)
+	assert.Nil(t, target.tls)
+
+	ctx := context.Background()
+	for _, proto := range []string{ProtocolHTTP, ProtocolGRPC, ProtocolStdout} {
+		target.protocol = proto
+
+		te, err := newTraceExporter(ctx, target)
+		require.NoError(t, err, proto)
+		assert.NoError(t, te.Shutdown(ctx))
+
+		me, err := newMetricExporter(ctx, target)
+		require.NoError(t, err, proto)
+		assert.NoError(t, me.Shutdown(ctx))
+
+		le, err := newLogExporter(ctx, target)
+		require.NoError(t, err, proto)
+		assert.NoError(t, le.Shutdown(ctx))
+	}
+}
+
+func TestOTelConfig_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	newTestCert(t, 1, "otel", nil).write(t, certFile, keyFile)
+
+	tcfg, err := OTelConfig{}.tlsConfig()
+	require.NoError(t, err)
+	assert.Nil(t, tcfg)
+
+	tcfg, err = OTelConfig{CACert: certFile, ClientCert: certFile, ClientKey: keyFile}.tlsConfig()
+	require.NoError(t, err)
+	assert.NotNil(t, tcfg.RootCAs)
+	assert.Len(t, tcfg.Certificates, 1)
+
+	_, err = OTelConfig{ClientCert: certFile}.tlsConfig()
+	assert.ErrorContains(t, err, "--otel-client-key")
+
+	_, err = OTelConfig{CACert: keyFile}.tlsConfig()
+	assert.ErrorContains(t, err, "no certificates")
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+var ErrNoClientCA = errors.New("no certificates in client CA bundle")
+
+type TLSConfig struct {
+	Cert       string `name:"cert" type:"existingfile" placeholder:"FILE" help:"Server certificate chain (PEM); enables TLS"`
+	Key        string `name:"key" type:"existingfile" placeholder:"FILE" help:"Server certificate private key (PEM)"`
+	ClientCA   string `name:"client-ca" type:"existingfile" placeholder:"FILE" help:"CA bundle (PEM) to verify client certificates"`
+	ClientAuth string `name:"client-auth" enum:"request,require" default:"request" help:"Client certificate mode with --tls-client-ca: request (verify if given) or require"`
+	ClientUser string `name:"client-user" enum:"cn,san-dns,san-email" default:"cn" help:"Client certificate field mapped to the user name"`
+}
+
+// Enabled checks if TLS termination is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.Cert != ""
+}
+
+// tlsCertificates keeps the current TLS configuration and rebuilds it on Reload.
+type tlsCertificates struct {
+	cfg     TLSConfig
+	current atomic.Pointer[tls.Config]
+}
+
+func newTLSCertificates(cfg TLSConfig) (*tlsCertificates, error) {
+	if cfg.Key == "" {
+		return nil, errors.New("--tls-key is required with --tls-cert")
+	}
+
+	ret := &tlsCertificates{cfg: cfg}
+
+	tcfg, err := ret.load()
+	if err != nil {
+		return nil, err
+	}
+
+	ret.current.Store(tcfg)
+	return ret, nil
+}
+
+func (c *tlsCertificates) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.cfg.Cert, c.cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate: %w", err)
+	}
+
+	tcfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if c.cfg.ClientCA != "" {
+		buf, err := os.ReadFile(c.cfg.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("%w: %s", ErrNoClientCA, c.cfg.ClientCA)
+		}
+
+		tcfg.ClientCAs = pool
+		tcfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.cfg.ClientAuth == "require" {
+			tcfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tcfg, nil
+}
+
+// Reload reads certificate, key and client CA files again. On error current ones are kept.
+func (c *tlsCertificates) Reload() error {
+	tcfg, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	c.current.Store(tcfg)
+
+	if leaf := tcfg.Certificates[0].Leaf; leaf != nil {
+		slog.Info("TLS certificate reloaded", "subject", leaf.Subject.String(), "not_after", leaf.NotAfter)
+	}
+
+	return nil
+}
+
+// Config returns listener configuration, which always uses the last loaded certificates.
+func (c *tlsCertificates) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current.Load(), nil
+		},
+	}
+}
+
+// reloadables returns the files to watch.
+func (c *tlsCertificates) reloadables() []reloadable {
+	ret := []reloadable{
+		{name: "tls-cert", path: c.cfg.Cert, r: c},
+		{name: "tls-key", path: c.cfg.Key, r: c},
+	}
+	if c.cfg.ClientCA != "" {
+		ret = append(ret, reloadable{name: "tls-client-ca", path: c.cfg.ClientCA, r: c})
+	}
+
+	return ret
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, serial int64, cn string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestTLSClientCerts(t *testing.T) {
+	dir := t.TempDir()
+	// server run saves doc/openapi.json
+	t.Chdir(dir)
+
+	cfg := TLSConfig{
+		Cert:       filepath.Join(dir, "server.crt"),
+		Key:        filepath.Join(dir, "server.key"),
+		ClientCA:   filepath.Join(dir, "ca.crt"),
+		ClientAuth: "request",
+		ClientUser: "cn",
+	}
+
+	ca := newTestCert(t, 1, "Test CA", nil)
+	ca.write(t, cfg.ClientCA, "")
+	newTestCert(t, 2, "server", ca).write(t, cfg.Cert, cfg.Key)
+	client := newTestCert(t, 3, "router", ca)
+
+	certs, err := newTLSCertificates(cfg)
+	require.NoError(t, err)
+
+	srv, listener, err := NewServer(&ServeCmd{Listen: "127.0.0.1:0"}, certs.Config())
+	require.NoError(t, err)
+	defer listener.Close() // nolint:errcheck
+
+	RegisterEndpoints(srv, fakeHTPasswd{user: "u", pass: "p"}, &fakeZoneController{}, WithClientCerts(cfg.ClientUser))
+	go func() { _ = srv.Run() }()
+	defer srv.Close() // nolint:errcheck
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(clientCerts ...tls.Certificate) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: clientCerts,
+		}}}
+
+		return c.Get("https://" + listener.Addr().String() + "/nic/update?hostname=test.example.com&myip=1.2.3.4")
+	}
+
+	resp, err := get(client.tlsCertificate())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, big.NewInt(2), resp.TLS.PeerCertificates[0].SerialNumber)
+
+	resp, err = get()
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// renewed server certificate is used after reload, broken one is ignored
+	newTestCert(t, 4, "server", ca).write(t, cfg.Cert, cfg.Key)
+	require.NoError(t, certs.Reload())
+	require.NoError(t, os.WriteFile(cfg.Key, []byte("broken"), 0600))
+	assert.Error(t, certs.Reload())
+
+	resp, err = get(client.tlsCertificate())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, big.NewInt(4), resp.TLS.PeerCertificates[0].SerialNumber)
+}
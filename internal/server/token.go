@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vooon/zoneomatic/internal/htpasswd"
+)
+
+type TokenCmd struct {
+	TokensFile string `name:"tokens" required:"" type:"path" placeholder:"FILE" help:"API tokens file"`
+
+	Create TokenCreateCmd `cmd:"" help:"Create a new token and print its secret"`
+	List   TokenListCmd   `cmd:"" help:"List tokens"`
+	Revoke TokenRevokeCmd `cmd:"" help:"Revoke a token"`
+}
+
+type TokenCreateCmd struct {
+	Name      string         `arg:"" help:"Token name"`
+	Owner     string         `name:"owner" required:"" help:"User the token acts for"`
+	ExpiresIn time.Duration  `name:"expires-in" help:"Token lifetime; 0 = never expires"`
+	Endpoints []string       `name:"allow-endpoint" enum:"ddns,acme,zm,pdns,admin" placeholder:"FAMILY,..." help:"Allowed endpoint families (ddns,acme,zm,pdns,admin); default all but admin"`
+	Zones     []string       `name:"allow-zone" placeholder:"ZONE,..." help:"Allow any name within the zones"`
+	Names     []string       `name:"allow-name" placeholder:"NAME,..." help:"Allow the names; *.example.com. allows all subdomains"`
+	Sources   []netip.Prefix `name:"allow-source" placeholder:"CIDR" help:"Allowed client networks; default any"`
+}
+
+type TokenListCmd struct{}
+
+type TokenRevokeCmd struct {
+	Token string `arg:"" help:"Token ID or name"`
+}
+
+func (cmd *TokenCreateCmd) Run(cli *Cli) error {
+	tokens, err := htpasswd.NewTokensFromFile(cli.Token.TokensFile)
+	if err != nil {
+		return err
+	}
+
+	var expires time.Time
+	if cmd.ExpiresIn > 0 {
+		expires = time.Now().Add(cmd.ExpiresIn).UTC().Truncate(time.Second)
+	}
+
+	secret, token, err := tokens.Create(cmd.Name, cmd.Owner, expires, htpasswd.Scopes{
+		Endpoints: cmd.Endpoints,
+		Zones:     cmd.Zones,
+		Names:     cmd.Names,
+		Sources:   cmd.Sources,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Created token %s (%s). The secret is shown only once:\n", token.Name, token.ID) // nolint:errcheck
+	fmt.Println(secret)
+	return nil
+}
+
+func (cmd *TokenListCmd) Run(cli *Cli) error {
+	tokens, err := htpasswd.NewTokensFromFile(cli.Token.TokensFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tOWNER\tCREATED\tEXPIRES\tSCOPES") // nolint:errcheck
+	for _, t := range tokens.List() {
+		expires := "never"
+		if !t.Expires.IsZero() {
+			expires = t.Expires.Format(time.RFC3339)
+			if t.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", // nolint:errcheck
+			t.ID, t.Name, t.Owner, t.Created.Format(time.RFC3339), expires, formatScopes(t.Scopes))
+	}
+
+	return tw.Flush()
+}
+
+func (cmd *TokenRevokeCmd) Run(cli *Cli) error {
+	tokens, err := htpasswd.NewTokensFromFile(cli.Token.TokensFile)
+	if err != nil {
+		return err
+	}
+
+	token, err := tokens.Revoke(cmd.Token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Revoked token %s (%s)\n", token.Name, token.ID) // nolint:errcheck
+	return nil
+}
+
+func formatScopes(s htpasswd.Scopes) string {
+	parts := make([]string, 0, 4)
+	if len(s.Endpoints) > 0 {
+		parts = append(parts, "endpoints="+strings.Join(s.Endpoints, ","))
+	}
+	if len(s.Zones) > 0 {
+		parts = append(parts, "zones="+strings.Join(s.Zones, ","))
+	}
+	if len(s.Names) > 0 {
+		parts = append(parts, "names="+strings.Join(s.Names, ","))
+	}
+	if len(s.Sources) > 0 {
+		sources := make([]string, 0, len(s.Sources))
+		for _, p := range s.Sources {
+			sources = append(sources, p.String())
+		}
+		parts = append(parts, "sources="+strings.Join(sources, ","))
+	}
+	if len(parts) == 0 {
+		return "*"
+	}
+
+	return strings.Join(parts, " ")
+}
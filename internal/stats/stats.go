@@ -0,0 +1,242 @@
+package stats
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Write results reported by RecordWrite
+const (
+	WriteChanged   = "changed"
+	WriteUnchanged = "unchanged"
+	WriteFailed    = "failed"
+)
+
+// Default collects process-wide counters.
+var Default = New()
+
+// ZoneSize holds record counts of a zone.
+type ZoneSize struct {
+	RRsets  int
+	Records int
+}
+
+// Snapshot is a point-in-time copy of all counters.
+type Snapshot struct {
+	Uptime          time.Duration
+	Updates         map[string]uint64
+	WritesChanged   uint64
+	WritesUnchanged uint64
+	WritesFailed    uint64
+	AuthFailures    uint64
+	AuthBlocked     uint64
+	Zones           map[string]ZoneSize
+	Serials         map[string]uint32
+	LastWrite       map[string]time.Time
+}
+
+// Stats keeps internal counters and mirrors them to the OpenTelemetry meter.
+type Stats struct {
+	start time.Time
+
+	mu        sync.Mutex
+	updates   map[string]uint64
+	zones     map[string]ZoneSize
+	serials   map[string]uint32
+	lastWrite map[string]time.Time
+
+	writesChanged   atomic.Uint64
+	writesUnchanged atomic.Uint64
+	writesFailed    atomic.Uint64
+	authFailures    atomic.Uint64
+	authBlocked     atomic.Uint64
+
+	updateCounter      metric.Int64Counter
+	writeCounter       metric.Int64Counter
+	authFailureCounter metric.Int64Counter
+	authBlockedCounter metric.Int64Counter
+}
+
+func New() *Stats {
+	s := &Stats{
+		start:     time.Now(),
+		updates:   make(map[string]uint64),
+		zones:     make(map[string]ZoneSize),
+		serials:   make(map[string]uint32),
+		lastWrite: make(map[string]time.Time),
+	}
+
+	meter := otel.Meter("github.com/vooon/zoneomatic/internal/stats")
+
+	// NOTE: instrument errors only mean a noop instrument, which is fine for counters.
+	s.updateCounter, _ = meter.Int64Counter("zoneomatic.updates",
+		metric.WithDescription("Update requests by endpoint"),
+		metric.WithUnit("{request}"),
+	)
+	s.writeCounter, _ = meter.Int64Counter("zoneomatic.zone.writes",
+		metric.WithDescription("Zone file writes by result"),
+		metric.WithUnit("{write}"),
+	)
+	s.authFailureCounter, _ = meter.Int64Counter("zoneomatic.auth.failures",
+		metric.WithDescription("Failed authentication attempts"),
+		metric.WithUnit("{request}"),
+	)
+	s.authBlockedCounter, _ = meter.Int64Counter("zoneomatic.auth.blocked",
+		metric.WithDescription("Requests rejected by the authentication failure limiter"),
+		metric.WithUnit("{request}"),
+	)
+
+	zonesGauge, _ := meter.Int64ObservableGauge("zoneomatic.zones",
+		metric.WithDescription("Number of managed zones"),
+		metric.WithUnit("{zone}"),
+	)
+	rrsetsGauge, _ := meter.Int64ObservableGauge("zoneomatic.zone.rrsets",
+		metric.WithDescription("Number of RRsets per zone"),
+		metric.WithUnit("{rrset}"),
+	)
+	recordsGauge, _ := meter.Int64ObservableGauge("zoneomatic.zone.records",
+		metric.WithDescription("Number of records per zone"),
+		metric.WithUnit("{record}"),
+	)
+	lastWriteGauge, _ := meter.Int64ObservableGauge("zoneomatic.zone.last_write",
+		metric.WithDescription("Unix time of the last zone file write"),
+		metric.WithUnit("s"),
+	)
+	serialGauge, _ := meter.Int64ObservableGauge("zoneomatic.zone.soa_serial",
+		metric.WithDescription("Current SOA serial of the zone"),
+		metric.WithUnit("{serial}"),
+	)
+
+	_, _ = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		o.ObserveInt64(zonesGauge, int64(len(s.zones)))
+		for zone, size := range s.zones {
+			attrs := metric.WithAttributes(attribute.String("zone.name", zone))
+			o.ObserveInt64(rrsetsGauge, int64(size.RRsets), attrs)
+			o.ObserveInt64(recordsGauge, int64(size.Records), attrs)
+		}
+		for zone, ts := range s.lastWrite {
+			o.ObserveInt64(lastWriteGauge, ts.Unix(), metric.WithAttributes(attribute.String("zone.name", zone)))
+		}
+		for zone, serial := range s.serials {
+			o.ObserveInt64(serialGauge, int64(serial), metric.WithAttributes(attribute.String("zone.name", zone)))
+		}
+
+		return nil
+	}, zonesGauge, rrsetsGauge, recordsGauge, lastWriteGauge, serialGauge)
+
+	return s
+}
+
+// RecordUpdate counts an update request received by the endpoint.
+func (s *Stats) RecordUpdate(ctx context.Context, endpoint string) {
+	s.mu.Lock()
+	s.updates[endpoint]++
+	s.mu.Unlock()
+
+	s.updateCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("endpoint", endpoint)))
+}
+
+// RecordWrite counts a zone file write attempt with one of Write* results.
+func (s *Stats) RecordWrite(ctx context.Context, zone, result string) {
+	switch result {
+	case WriteChanged:
+		s.writesChanged.Add(1)
+
+		s.mu.Lock()
+		s.lastWrite[zone] = time.Now()
+		s.mu.Unlock()
+	case WriteUnchanged:
+		s.writesUnchanged.Add(1)
+	case WriteFailed:
+		s.writesFailed.Add(1)
+	}
+
+	s.writeCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("zone.name", zone),
+		attribute.String("result", result),
+	))
+}
+
+// RecordAuthFailure counts a failed authentication attempt.
+func (s *Stats) RecordAuthFailure(ctx context.Context) {
+	s.authFailures.Add(1)
+	s.authFailureCounter.Add(ctx, 1)
+}
+
+// RecordAuthBlocked counts a request rejected by the auth failure limiter.
+// Reason is the kind of the locked out key, e.g. "ip" or "user".
+func (s *Stats) RecordAuthBlocked(ctx context.Context, reason string) {
+	s.authBlocked.Add(1)
+	s.authBlockedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+// SetZoneSize updates record counts of the zone.
+func (s *Stats) SetZoneSize(zone string, size ZoneSize) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.zones[zone] = size
+}
+
+// SetZoneSerial updates the current SOA serial of the zone.
+func (s *Stats) SetZoneSerial(zone string, serial uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.serials[zone] = serial
+}
+
+// RemoveZone drops gauges of a zone which is no longer managed.
+func (s *Stats) RemoveZone(zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.zones, zone)
+	delete(s.serials, zone)
+	delete(s.lastWrite, zone)
+}
+
+// Snapshot returns a copy of all counters.
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Snapshot{
+		Uptime:          time.Since(s.start),
+		Updates:         maps.Clone(s.updates),
+		WritesChanged:   s.writesChanged.Load(),
+		WritesUnchanged: s.writesUnchanged.Load(),
+		WritesFailed:    s.writesFailed.Load(),
+		AuthFailures:    s.authFailures.Load(),
+		AuthBlocked:     s.authBlocked.Load(),
+		Zones:           maps.Clone(s.zones),
+		Serials:         maps.Clone(s.serials),
+		LastWrite:       maps.Clone(s.lastWrite),
+	}
+}
+
+// TotalSize sums record counts of all zones.
+func (s Snapshot) TotalSize() (total ZoneSize) {
+	for _, size := range s.Zones {
+		total.RRsets += size.RRsets
+		total.Records += size.Records
+	}
+
+	return
+}
+
+// ZoneNames returns sorted zone names.
+func (s Snapshot) ZoneNames() []string {
+	return slices.Sorted(maps.Keys(s.Zones))
+}
@@ -0,0 +1,38 @@
+package stats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	s.RecordUpdate(ctx, "ddns")
+	s.RecordUpdate(ctx, "ddns")
+	s.RecordUpdate(ctx, "pdns")
+	s.RecordWrite(ctx, "example.com.", WriteChanged)
+	s.RecordWrite(ctx, "example.com.", WriteUnchanged)
+	s.RecordWrite(ctx, "example.org.", WriteFailed)
+	s.RecordAuthFailure(ctx)
+	s.RecordAuthBlocked(ctx, "ip")
+	s.SetZoneSize("example.com.", ZoneSize{RRsets: 3, Records: 4})
+	s.SetZoneSize("example.org.", ZoneSize{RRsets: 2, Records: 2})
+	s.SetZoneSerial("example.com.", 2024010101)
+
+	snap := s.Snapshot()
+	assert.Equal(t, map[string]uint64{"ddns": 2, "pdns": 1}, snap.Updates)
+	assert.Equal(t, uint64(1), snap.WritesChanged)
+	assert.Equal(t, uint64(1), snap.WritesUnchanged)
+	assert.Equal(t, uint64(1), snap.WritesFailed)
+	assert.Equal(t, uint64(1), snap.AuthFailures)
+	assert.Equal(t, uint64(1), snap.AuthBlocked)
+	assert.Equal(t, ZoneSize{RRsets: 5, Records: 6}, snap.TotalSize())
+	assert.Equal(t, []string{"example.com.", "example.org."}, snap.ZoneNames())
+	assert.Equal(t, map[string]uint32{"example.com.": 2024010101}, snap.Serials)
+	assert.Contains(t, snap.LastWrite, "example.com.")
+	assert.NotContains(t, snap.LastWrite, "example.org.")
+}
@@ -0,0 +1,29 @@
+package zone
+
+import (
+	"context"
+	"net/netip"
+)
+
+// Actor is who makes the change, it goes to the audit log, git commits and hooks.
+type Actor struct {
+	User string
+	// Token is the API token ID, if the change is made with a token
+	Token string
+	// Issuer is the JWT issuer, if the change is made with a JWT
+	Issuer   string
+	ClientIP netip.Addr
+}
+
+type actorKey struct{}
+
+// WithActor sets the actor of updates in the context.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
@@ -0,0 +1,101 @@
+package zone
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vooon/zoneomatic/internal/audit"
+	"github.com/vooon/zoneomatic/pkg/zonefile"
+)
+
+// auditDisabledPrefix marks disabled record values in audit entries
+const auditDisabledPrefix = "disabled:"
+
+// WithAuditLog records every zone change to the log.
+func WithAuditLog(l audit.Logger) Option {
+	return func(d *DomainCtrl) {
+		d.audit = l
+	}
+}
+
+// auditEntries returns changes of RRsets touched by the updates.
+// RRsets which are the same before and after are skipped.
+func (s *File) auditEntries(ctx context.Context, op string, updates []recordUpdate, oldEntries, newEntries []zonefile.Entry, oldSerial, newSerial uint32) []audit.Entry {
+	origin := normalizeZoneName(s.origin)
+	actor, _ := ActorFromContext(ctx)
+
+	base := audit.Entry{
+		Time:      time.Now().UTC(),
+		User:      actor.User,
+		Token:     actor.Token,
+		Issuer:    actor.Issuer,
+		Endpoint:  op,
+		Zone:      origin,
+		OldSerial: oldSerial,
+		NewSerial: newSerial,
+	}
+	if actor.ClientIP.IsValid() {
+		base.ClientIP = actor.ClientIP.String()
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		base.TraceID = sc.TraceID().String()
+	}
+
+	seen := make(map[string]struct{})
+	ret := make([]audit.Entry, 0, len(updates))
+	for _, u := range updates {
+		for _, m := range u.Matchers {
+			if m.Domain == nil || m.RRType == 0 {
+				continue
+			}
+
+			name := strings.ToLower(absoluteRecordName(m.Domain, origin))
+			typ := dns.TypeToString[m.RRType]
+			key := name + "\x00" + typ
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			rrset := Matcher{Domain: m.Domain, RRType: m.RRType, Disabled: true}
+			oldValues := auditValues(rrset, oldEntries)
+			newValues := auditValues(rrset, newEntries)
+			if slices.Equal(oldValues, newValues) {
+				continue
+			}
+
+			e := base
+			e.Name = name
+			e.Type = typ
+			e.Old = oldValues
+			e.New = newValues
+			ret = append(ret, e)
+		}
+	}
+
+	return ret
+}
+
+func auditValues(m Matcher, entries []zonefile.Entry) []string {
+	ret := make([]string, 0)
+	for _, ent := range entries {
+		if !m.Match(ent) {
+			continue
+		}
+
+		if ent.IsComment {
+			rec, _ := parseDisabledEntry(ent)
+			ret = append(ret, auditDisabledPrefix+entryContent(rec))
+			continue
+		}
+
+		ret = append(ret, entryContent(ent))
+	}
+
+	return ret
+}
@@ -0,0 +1,63 @@
+package zone
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vooon/zoneomatic/internal/audit"
+)
+
+type fakeAuditLog []audit.Entry
+
+func (l *fakeAuditLog) Log(ctx context.Context, entries ...audit.Entry) error {
+	*l = append(*l, entries...)
+	return nil
+}
+
+func TestFile_AuditLog(t *testing.T) {
+	var log fakeAuditLog
+	f := newZoneTempWithOpts(t, "./testdata/at.example.com.zone", WithAuditLog(&log))
+
+	ctx := WithActor(context.Background(), Actor{
+		User:     "u",
+		Token:    "tok",
+		ClientIP: netip.MustParseAddr("192.0.2.10"),
+	})
+
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "loop", []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("::1"),
+	}))
+	require.Len(t, log, 1, "unchanged AAAA is not logged")
+
+	e := log[0]
+	assert.Equal(t, "u", e.User)
+	assert.Equal(t, "tok", e.Token)
+	assert.Equal(t, "192.0.2.10", e.ClientIP)
+	assert.Equal(t, OpDDNS, e.Endpoint)
+	assert.Equal(t, "at.example.com.", e.Zone)
+	assert.Equal(t, "loop.at.example.com.", e.Name)
+	assert.Equal(t, "A", e.Type)
+	assert.Equal(t, []string{"127.0.0.1"}, e.Old)
+	assert.Equal(t, []string{"192.0.2.1"}, e.New)
+	assert.Equal(t, uint32(1763822925), e.OldSerial)
+	assert.Greater(t, e.NewSerial, e.OldSerial)
+	assert.False(t, e.Time.IsZero())
+
+	// no change - no entry
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "loop", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+	assert.Len(t, log, 1)
+
+	_, err := f.ReplaceRRSet(ctx, "new.at.example.com.", "TXT", 60, []string{"a"}, []string{"b"})
+	require.NoError(t, err)
+	require.Len(t, log, 2)
+	assert.Equal(t, OpPDNS, log[1].Endpoint)
+	assert.Equal(t, "new.at.example.com.", log[1].Name)
+	assert.Empty(t, log[1].Old)
+	assert.Equal(t, []string{"a", "disabled:b"}, log[1].New)
+	assert.Equal(t, e.NewSerial, log[1].OldSerial)
+}
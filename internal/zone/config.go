@@ -0,0 +1,90 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// FileConfig is per-zone settings of a zone file.
+type FileConfig struct {
+	Path string
+	// AcmeTTL overrides WithAcmeTTL, if set
+	AcmeTTL *int
+	// DefaultTTL is written to records set without TTL, 0 = use zone $TTL
+	DefaultTTL int
+	// SerialPolicy is one of SerialPolicies, empty = SerialAuto
+	SerialPolicy string
+	// Operations allowed to update the zone (OpDDNS, OpACME, OpZM, OpPDNS), empty = all
+	Operations []string
+	// Hooks run after each saved change
+	Hooks []Hook
+	// Notify lists secondaries (host or host:port) which get DNS NOTIFY after each saved change
+	Notify []string
+}
+
+// Operations lists update operations which can be allowed per zone.
+var Operations = []string{OpDDNS, OpACME, OpZM, OpPDNS}
+
+// Hook is a command run after each saved change of the zone, e.g. to reload the DNS server.
+// It gets ZM_ZONE, ZM_ZONE_FILE, ZM_SERIAL, ZM_OPERATION and ZM_USER environment variables.
+type Hook struct {
+	Command []string
+	// Timeout kills the command, 0 = 10s
+	Timeout time.Duration
+}
+
+// Validate checks the settings, it does not access the file.
+func (c FileConfig) Validate() error {
+	if c.Path == "" {
+		return errors.New("file is required")
+	}
+	if c.AcmeTTL != nil && *c.AcmeTTL < 0 {
+		return fmt.Errorf("acme ttl must not be negative: %d", *c.AcmeTTL)
+	}
+	if c.DefaultTTL < 0 {
+		return fmt.Errorf("default ttl must not be negative: %d", c.DefaultTTL)
+	}
+	if err := CheckSerialPolicy(c.SerialPolicy); err != nil {
+		return err
+	}
+	for _, op := range c.Operations {
+		if !slices.Contains(Operations, op) {
+			return fmt.Errorf("unknown operation %q, expected one of %v", op, Operations)
+		}
+	}
+	for i, h := range c.Hooks {
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			return fmt.Errorf("hook %d: command is required", i)
+		}
+		if h.Timeout < 0 {
+			return fmt.Errorf("hook %d: timeout must not be negative", i)
+		}
+	}
+	for _, t := range c.Notify {
+		if _, err := notifyAddr(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyAddr adds the default DNS port to the target.
+func notifyAddr(target string) (string, error) {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target, nil
+	}
+	if target == "" {
+		return "", errors.New("empty notify target")
+	}
+
+	addr := net.JoinHostPort(target, "53")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", fmt.Errorf("invalid notify target %q: %w", target, err)
+	}
+
+	return addr, nil
+}
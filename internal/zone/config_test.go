@@ -0,0 +1,60 @@
+package zone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileConfig_Validate(t *testing.T) {
+	neg := -1
+	tests := []struct {
+		name string
+		cfg  FileConfig
+		err  string
+	}{
+		{"ok", FileConfig{Path: "a.zone", SerialPolicy: SerialDate, Operations: []string{OpDDNS},
+			Hooks: []Hook{{Command: []string{"true"}}}, Notify: []string{"192.0.2.1", "[2001:db8::1]:5353", "ns1.example.com"}}, ""},
+		{"no path", FileConfig{}, "file is required"},
+		{"acme ttl", FileConfig{Path: "a.zone", AcmeTTL: &neg}, "acme ttl must not be negative: -1"},
+		{"default ttl", FileConfig{Path: "a.zone", DefaultTTL: -5}, "default ttl must not be negative: -5"},
+		{"serial", FileConfig{Path: "a.zone", SerialPolicy: "random"}, `unknown serial policy: "random"`},
+		{"operation", FileConfig{Path: "a.zone", Operations: []string{"axfr"}}, `unknown operation "axfr", expected one of [ddns acme zm pdns]`},
+		{"hook", FileConfig{Path: "a.zone", Hooks: []Hook{{}}}, "hook 0: command is required"},
+		{"notify", FileConfig{Path: "a.zone", Notify: []string{""}}, "empty notify target"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		policy, old, expected string
+	}{
+		{SerialIncrement, "1", "2"},
+		{SerialIncrement, "4294967295", "1"},
+		{SerialEpoch, "1", "1772600767"},
+		{SerialEpoch, "1772600767", "1772600768"},
+		{SerialDate, "1", "2026030400"},
+		{SerialDate, "2026030400", "2026030401"},
+		{SerialDate, "2026030517", "2026030518"},
+		{SerialIncrement, "bad", "bad"},
+		{"", "2026030400", "2026030401"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, string(nextSerial(tc.policy, []byte(tc.old), now)), "%s %s", tc.policy, tc.old)
+	}
+}
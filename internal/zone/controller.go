@@ -8,17 +8,22 @@ import (
 	"io"
 	"log/slog"
 	"net/netip"
-	"os"
 	"path"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
+	"github.com/vooon/zoneomatic/internal/audit"
+	"github.com/vooon/zoneomatic/internal/stats"
 	"github.com/vooon/zoneomatic/pkg/dnsfmt"
 	"github.com/vooon/zoneomatic/pkg/fileutil"
 	"github.com/vooon/zoneomatic/pkg/zonefile"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrSoaNotFound emited if zone file does not have SOA record, which is mandatory
@@ -28,8 +33,19 @@ var (
 	ErrNoMatchers     = errors.New("no record matchers provided")
 	ErrOriginChanged  = errors.New("zone origin changed")
 	ErrZoneNotFound   = errors.New("zone not found")
+	ErrUnknownChange  = errors.New("unknown change type")
+	ErrDuplicateZone  = errors.New("duplicate zone")
+	// ErrZoneConflict emitted if the zone file keeps changing by someone else during update
+	ErrZoneConflict = errors.New("zone file changed during update")
+	// ErrOperationNotAllowed emitted if the zone config does not allow the update operation
+	ErrOperationNotAllowed = errors.New("operation not allowed for zone")
+	// ErrTTLMismatch emitted if records added to an RRSet would have a TTL other than the existing ones
+	ErrTTLMismatch = errors.New("ttl differs from rrset ttl")
 )
 
+// maxConflictRetries limits update retries after the zone file changed under us
+const maxConflictRetries = 3
+
 // EmptyPlaceholder will be used instead of empty ACME TXT because we cannot really set ""
 const EmptyPlaceholder = "placeholder"
 
@@ -44,17 +60,27 @@ type Controller interface {
 	// UpdateACMEChallenge changes ACME TXT record for DNS-01 challenge
 	UpdateACMEChallenge(ctx context.Context, domain string, newToken, oldToken string) error
 	// ReplaceRRSet replaces or creates the requested RRSet in a specific zone.
-	ReplaceRRSet(ctx context.Context, zoneName, name, typ string, ttl int, values []string) (changed bool, err error)
+	// Disabled values are kept in the zone file as DisabledPrefix comments.
+	ReplaceRRSet(ctx context.Context, zoneName, name, typ string, ttl int, values, disabled []string) (changed bool, err error)
 	// DeleteRRSet removes the requested RRSet from a specific zone.
 	DeleteRRSet(ctx context.Context, zoneName, name, typ string) (changed bool, err error)
+	// PatchRRSets applies all changes to a specific zone at once.
+	// Either all changes are written or none of them.
+	PatchRRSets(ctx context.Context, zoneName string, changes []RRSetChange) (changed bool, err error)
 	// ZMUpdateRecord replace record values
 	ZMUpdateRecord(ctx context.Context, domain string, typ string, ttl int, values []string) (changed bool, err error)
+	// CheckZones checks that all zone files can be loaded and written.
+	CheckZones(ctx context.Context) []ZoneStatus
+	// Reload replaces the zone list, keeping the current one on error.
+	Reload(ctx context.Context, zones ...FileConfig) error
 }
 
 type Matcher struct {
 	Domain []byte
 	RRType uint16
 	Values [][]byte
+	// Disabled also matches records commented out with DisabledPrefix
+	Disabled bool
 }
 
 type Matchers []Matcher
@@ -71,16 +97,39 @@ func WithAcmeTTL(ttl int) Option {
 }
 
 type File struct {
-	origin  string
-	path    string
-	lg      *slog.Logger
-	mu      sync.Mutex
-	acmeTTL int
+	origin       string
+	path         string
+	lg           *slog.Logger
+	mu           sync.Mutex
+	acmeTTL      int
+	defaultTTL   int
+	serialPolicy string
+	operations   []string
+	hooks        []Hook
+	notify       []string
+	audit        audit.Logger
+	git          *gitRepo
+	lockTimeout  time.Duration
+	// loaded is the file version of the last load, checked before write
+	loaded fileutil.Version
+	// removed is set by Reload, so updates which found the file before do not write it
+	removed bool
+	// hookQueue runs hooks after the update returned
+	hookQueue hookQueue
+	// beforeVersionCheck is set by tests to change the file between load and write
+	beforeVersionCheck func()
 }
 
 type DomainCtrl struct {
-	files   []*File
-	acmeTTL int
+	// mu guards files, reloadMu serializes Reload
+	mu          sync.RWMutex
+	reloadMu    sync.Mutex
+	files       []*File
+	acmeTTL     int
+	audit       audit.Logger
+	git         *GitConfig
+	repos       map[string]*gitRepo
+	lockTimeout time.Duration
 }
 
 func New(zonefiles ...string) (Controller, error) {
@@ -88,32 +137,122 @@ func New(zonefiles ...string) (Controller, error) {
 }
 
 func NewWithOptions(opts []Option, zonefiles ...string) (Controller, error) {
-
-	ret := make([]*File, 0, len(zonefiles))
+	cfgs := make([]FileConfig, 0, len(zonefiles))
 	for _, fl := range zonefiles {
-		fileName := path.Base(fl)
-		f := &File{
-			path: fl,
-			lg:   slog.Default().With("zone_file", fileName),
+		cfgs = append(cfgs, FileConfig{Path: fl})
+	}
+
+	return NewWithConfigs(opts, cfgs...)
+}
+
+// NewWithConfigs creates the controller for zone files with per-zone settings.
+func NewWithConfigs(opts []Option, zones ...FileConfig) (Controller, error) {
+	dc := &DomainCtrl{lockTimeout: DefaultLockTimeout}
+	for _, opt := range opts {
+		opt(dc)
+	}
+
+	dc.files = make([]*File, 0, len(zones))
+	for _, zc := range zones {
+		f, err := dc.newFile(zc)
+		if err != nil {
+			return nil, err
 		}
 
-		_, _, err := f.load()
+		dc.files = append(dc.files, f)
+	}
+
+	if err := checkDuplicateFiles(dc.files); err != nil {
+		return nil, err
+	}
+
+	return dc, nil
+}
+
+// newFile validates the config and loads the zone file.
+func (dc *DomainCtrl) newFile(zc FileConfig) (*File, error) {
+	fileName := path.Base(zc.Path)
+	if err := zc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid zone config: %s: %w", fileName, err)
+	}
+
+	f := &File{
+		path:        zc.Path,
+		lg:          slog.Default().With("zone_file", fileName),
+		audit:       dc.audit,
+		lockTimeout: dc.lockTimeout,
+	}
+	f.configure(zc, dc.acmeTTL)
+
+	zf, soa, err := f.load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load zone: %s: %w", fileName, err)
+	}
+
+	// later updated by writes only
+	zoneName := normalizeZoneName(f.origin)
+	stats.Default.SetZoneSize(zoneName, zoneSize(zf.Entries()))
+	stats.Default.SetZoneSerial(zoneName, serialNumber(soaSerial(soa)))
+
+	if dc.git != nil {
+		f.git, err = dc.gitRepo(zc.Path)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load zone: %s: %w", fileName, err)
+			return nil, fmt.Errorf("git repository of zone: %s: %w", fileName, err)
 		}
 
-		ret = append(ret, f)
+		// the lock file is never removed, it would leave the repository dirty
+		if f.lockTimeout != 0 {
+			lockFile := fileutil.LockPath(zc.Path)
+			if ignored, err := f.git.ignored(lockFile); err == nil && !ignored {
+				f.lg.Warn("Zone lock file is not ignored by git, add .*.lock to .gitignore", "lock_file", lockFile)
+			}
+		}
 	}
 
-	dc := &DomainCtrl{files: ret}
-	for _, opt := range opts {
-		opt(dc)
+	return f, nil
+}
+
+// configure applies per-zone settings, acmeTTL is used if the config does not set one.
+// Must be called with s.mu held if the file is in use.
+func (s *File) configure(zc FileConfig, acmeTTL int) {
+	s.acmeTTL = acmeTTL
+	if zc.AcmeTTL != nil {
+		s.acmeTTL = *zc.AcmeTTL
 	}
-	for _, f := range dc.files {
-		f.acmeTTL = dc.acmeTTL
+	s.defaultTTL = zc.DefaultTTL
+	s.serialPolicy = zc.SerialPolicy
+	s.operations = zc.Operations
+	s.hooks = zc.Hooks
+	s.notify = zc.Notify
+}
+
+// checkDuplicateFiles rejects a file configured twice and zones with the same origin.
+func checkDuplicateFiles(files []*File) error {
+	paths := make(map[string]struct{}, len(files))
+	origins := make(map[string]*File, len(files))
+	for _, f := range files {
+		key := filepath.Clean(f.path)
+		if _, ok := paths[key]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateZone, f.path)
+		}
+		paths[key] = struct{}{}
+
+		origin := strings.ToLower(normalizeZoneName(f.origin))
+		if prev, ok := origins[origin]; ok {
+			return fmt.Errorf("%w: origin %s in %s and %s", ErrDuplicateZone, origin, prev.path, f.path)
+		}
+		origins[origin] = f
 	}
 
-	return dc, nil
+	return nil
+}
+
+// zoneFiles returns the current files, safe to use during Reload.
+func (s *DomainCtrl) zoneFiles() []*File {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.files
 }
 
 func (s *DomainCtrl) UpdateDDNSAddress(ctx context.Context, domain string, addrs []netip.Addr) (err error) {
@@ -213,7 +352,7 @@ func (s *DomainCtrl) ZMUpdateRecord(ctx context.Context, domain string, typ stri
 func (s *DomainCtrl) findZoneFile(ctx context.Context, lg *slog.Logger, domainDot string) *File {
 	var best *File
 	bestLen := -1
-	for _, fl := range s.files {
+	for _, fl := range s.zoneFiles() {
 		lg.DebugContext(ctx, "Check file", "file_origin", fl.origin)
 		if !domainMatchesOrigin(domainDot, fl.origin) {
 			continue
@@ -243,6 +382,18 @@ func domainMatchesOrigin(domain, origin string) bool {
 }
 
 func (m Matcher) Match(e zonefile.Entry) bool {
+	if e.IsComment {
+		if !m.Disabled {
+			return false
+		}
+
+		rec, ok := parseDisabledEntry(e)
+		if !ok {
+			return false
+		}
+		e = rec
+	}
+
 	if m.Domain != nil && !dnsNamesEqual(e.Domain(), m.Domain) {
 		return false
 	}
@@ -263,7 +414,7 @@ func dnsNamesEqual(a, b []byte) bool {
 }
 
 func (m Matcher) String() string {
-	args := make([]string, 0, 3)
+	args := make([]string, 0, 4)
 
 	if m.Domain != nil {
 		args = append(args, fmt.Sprintf("domain:%s", m.Domain))
@@ -274,6 +425,9 @@ func (m Matcher) String() string {
 	if m.Values != nil {
 		args = append(args, fmt.Sprintf("value:%v", m.Values))
 	}
+	if m.Disabled {
+		args = append(args, "disabled")
+	}
 
 	return fmt.Sprintf("Match(%s)", strings.Join(args, " "))
 }
@@ -288,16 +442,31 @@ func (mm Matchers) Match(e zonefile.Entry) bool {
 	return false
 }
 
-func (s *File) load() (zf *zonefile.Zonefile, soa *zonefile.Entry, err error) {
-	buf, err := os.ReadFile(s.path)
+// loadStats are the file size and phase durations of a load, recorded by updates only,
+// so reads of the zone do not skew them.
+type loadStats struct {
+	size  int
+	read  time.Duration
+	parse time.Duration
+}
+
+func (s *File) load(_ context.Context) (zf *zonefile.Zonefile, soa *zonefile.Entry, err error) {
+	zf, soa, _, err = s.loadWithStats()
+	return
+}
+
+func (s *File) loadWithStats() (zf *zonefile.Zonefile, soa *zonefile.Entry, ls loadStats, err error) {
+	start := time.Now()
+	buf, version, err := fileutil.ReadFileVersion(s.path)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, ls, err
 	}
+	loadDone := time.Now()
 
 	var zfErr *zonefile.ParsingError
 	zf, zfErr = zonefile.Load(buf)
 	if zfErr != nil {
-		return nil, nil, zfErr
+		return nil, nil, ls, zfErr
 	}
 
 	ok := false
@@ -333,7 +502,7 @@ func (s *File) load() (zf *zonefile.Zonefile, soa *zonefile.Entry, err error) {
 		}
 	}
 	if !ok {
-		return nil, nil, ErrSoaNotFound
+		return nil, nil, ls, ErrSoaNotFound
 	}
 
 	if origin == "" {
@@ -344,21 +513,111 @@ func (s *File) load() (zf *zonefile.Zonefile, soa *zonefile.Entry, err error) {
 		s.lg.Info("Detected origin", "origin", origin)
 		s.origin = origin
 	} else if s.origin != origin {
-		return nil, nil, fmt.Errorf("%w: prev=%s new=%s", ErrOriginChanged, s.origin, origin)
+		return nil, nil, ls, fmt.Errorf("%w: prev=%s new=%s", ErrOriginChanged, s.origin, origin)
 	}
 
+	s.loaded = version
+	ls = loadStats{size: len(buf), read: loadDone.Sub(start), parse: time.Since(loadDone)}
+
 	// PrintEntries(zf.Entries(), os.Stdout)
 
 	return
 }
 
-func (s *File) updateRecords(ctx context.Context, lg1 *slog.Logger, matchers Matchers, values []zonefile.Entry, allowNew bool) (changed bool, err error) {
+// zoneSize counts enabled records and RRsets in the zone entries.
+func zoneSize(entries []zonefile.Entry) stats.ZoneSize {
+	rrsets := make(map[string]struct{})
+	records := 0
+	prevDomain := []byte{}
+	for _, ent := range entries {
+		if ent.IsComment || ent.IsControl || ent.RRType() == 0 {
+			continue
+		}
+
+		dom := ent.Domain()
+		if dom != nil {
+			prevDomain = dom
+		} else {
+			dom = prevDomain
+		}
+
+		records++
+		rrsets[strings.ToLower(string(dom))+"\x00"+string(ent.Type())] = struct{}{}
+	}
+
+	return stats.ZoneSize{RRsets: len(rrsets), Records: records}
+}
+
+// soaSerial returns the serial value of the SOA entry.
+func soaSerial(soa *zonefile.Entry) []byte {
+	values := soa.Values()
+	if len(values) < 3 {
+		return nil
+	}
+
+	return values[2]
+}
+
+// serialNumber returns 0 if the serial is not a number.
+func serialNumber(serial []byte) uint32 {
+	n, _ := strconv.ParseUint(string(serial), 10, 32)
+	return uint32(n)
+}
+
+// ttlField returns the TTL column of a record line, empty to use the zone $TTL.
+func ttlField(ttl int) string {
+	if ttl <= 0 {
+		return ""
+	}
+
+	return " " + strconv.Itoa(ttl)
+}
+
+// checkUpdate returns an error if the file was dropped by Reload or the zone config does not allow op.
+// Must be called with s.mu held.
+func (s *File) checkUpdate(op string) error {
+	if s.removed {
+		return fmt.Errorf("%w: %s", ErrZoneNotFound, normalizeZoneName(s.origin))
+	}
+	if len(s.operations) == 0 || slices.Contains(s.operations, op) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s: %s", ErrOperationNotAllowed, normalizeZoneName(s.origin), op)
+}
+
+// recordUpdate replaces entries matched by Matchers with Values.
+type recordUpdate struct {
+	Matchers Matchers
+	Values   []zonefile.Entry
+	// AllowNew appends Values when nothing matches, otherwise ErrRecordNotFound returned
+	AllowNew bool
+	// Anchor, if set, places new Values after the last entry it matches instead of the end of the file
+	Anchor Matchers
+	// TTL, if set, must be the TTL of all entries Anchor matches, so an RRSet keeps a single TTL (RFC 2181 5.2)
+	TTL int
+}
+
+func (s *File) updateRecords(ctx context.Context, lg *slog.Logger, op string, matchers Matchers, values []zonefile.Entry, allowNew bool) (changed bool, err error) {
+	return s.updateRecordsBatch(ctx, lg, op, recordUpdate{Matchers: matchers, Values: values, AllowNew: allowNew})
+}
+
+// updateRecordsBatch applies all updates in order and writes the file once.
+// Op is the update operation recorded to the audit log.
+func (s *File) updateRecordsBatch(ctx context.Context, lg *slog.Logger, op string, updates ...recordUpdate) (changed bool, err error) {
 	ctx, span := zoneTracer.Start(ctx, "zone.file.update_records")
+	matcherCount, valueCount, allowNew := 0, 0, true
+	for _, u := range updates {
+		matcherCount += len(u.Matchers)
+		valueCount += len(u.Values)
+		allowNew = allowNew && u.AllowNew
+	}
 	span.SetAttributes(
 		attribute.String("zone.file", path.Base(s.path)),
 		attribute.Bool("zone.allow_new", allowNew),
-		attribute.Int("zone.matcher_count", len(matchers)),
-		attribute.Int("zone.new_entry_count", len(values)),
+		attribute.Int("zone.update_count", len(updates)),
+		attribute.Int("zone.matcher_count", matcherCount),
+		attribute.Int("zone.new_entry_count", valueCount),
 	)
 	defer func() {
 		span.SetAttributes(attribute.Bool("zone.changed", changed))
@@ -366,87 +625,257 @@ func (s *File) updateRecords(ctx context.Context, lg1 *slog.Logger, matchers Mat
 		span.End()
 	}()
 
-	lg := lg1.With("matchers", matchers)
-
-	if len(matchers) == 0 {
-		return false, ErrNoMatchers
+	for _, u := range updates {
+		if len(u.Matchers) == 0 {
+			return false, ErrNoMatchers
+		}
 	}
 
-	zf, _, err := s.load()
+	zoneName := normalizeZoneName(s.origin)
+	defer func() {
+		if errors.Is(err, ErrRecordNotFound) {
+			return
+		}
+
+		result := stats.WriteUnchanged
+		if err != nil {
+			result = stats.WriteFailed
+		} else if changed {
+			result = stats.WriteChanged
+		}
+		stats.Default.RecordWrite(ctx, zoneName, result)
+	}()
+
+	// other processes may change the file between load and write
+	unlock, err := s.lock(ctx, lg)
 	if err != nil {
 		return
 	}
+	defer unlock()
 
-	// 1. Copy all non-matching elements, insert new values on the place of first element
-	oldEntries := zf.Entries()
-	newEntries := make([]zonefile.Entry, 0, len(oldEntries))
-	found := false
-	matchedCount := 0
-	for idx, ent := range oldEntries {
-		if matchers.Match(ent) {
-			matchedCount++
-			if !found {
-				lg.DebugContext(ctx, "First matching record found", "index", idx, "old_values", ent.ValuesStrings())
-				newEntries = append(newEntries, values...)
-				found = true
-			} else {
-				lg.DebugContext(ctx, "Remove matching record", "index", idx, "old_values", ent.ValuesStrings())
-			}
-			continue
+	var w zoneWrite
+	for attempt := 1; ; attempt++ {
+		w, err = s.writeUpdates(ctx, lg, zoneName, updates)
+		if !errors.Is(err, fileutil.ErrFileChanged) {
+			break
+		}
+		if attempt > maxConflictRetries {
+			err = fmt.Errorf("%w: %s", ErrZoneConflict, path.Base(s.path))
+			return
 		}
 
-		newEntries = append(newEntries, ent)
+		lg.WarnContext(ctx, "Zone file changed during update, retrying", "attempt", attempt)
+	}
+	changed = w.changed
+	if err != nil || !changed {
+		return
 	}
-	span.SetAttributes(
-		attribute.Int("zone.old_entry_count", len(oldEntries)),
-		attribute.Int("zone.matched_entry_count", matchedCount),
-	)
 
-	// 2. If old record not found - add new values to the end, if allowed
-	if !found {
-		if !allowNew {
-			lg.ErrorContext(ctx, "No matching record not found, but insert is not allowed.")
-			return false, ErrRecordNotFound
+	stats.Default.SetZoneSize(zoneName, zoneSize(w.newEntries))
+	stats.Default.SetZoneSerial(zoneName, serialNumber(w.newSerial))
+
+	lg.InfoContext(ctx, "File saved", "changed", changed, "serial", string(w.newSerial))
+
+	// the change is already saved, so failures below are only logged
+	var entries []audit.Entry
+	if s.audit != nil || s.git != nil {
+		entries = s.auditEntries(ctx, op, updates, w.oldEntries, w.newEntries, serialNumber(w.oldSerial), serialNumber(w.newSerial))
+	}
+	if s.audit != nil {
+		if aerr := s.audit.Log(ctx, entries...); aerr != nil {
+			lg.ErrorContext(ctx, "Failed to write audit log", "error", aerr)
 		}
+	}
+	// git add must see our write, not a later one of another process
+	s.gitCommit(ctx, lg, op, entries, string(w.newSerial))
+	unlock()
+
+	s.runHooks(ctx, lg, op, string(w.newSerial))
+	s.sendNotify(ctx, lg)
+	return
+}
+
+// zoneWrite is the result of one load, apply and write attempt.
+type zoneWrite struct {
+	changed    bool
+	oldEntries []zonefile.Entry
+	newEntries []zonefile.Entry
+	oldSerial  []byte
+	newSerial  []byte
+}
+
+// writeUpdates loads the file, applies updates and writes the file if changed.
+// It returns fileutil.ErrFileChanged if the file was changed by someone else after load.
+func (s *File) writeUpdates(ctx context.Context, lg *slog.Logger, zoneName string, updates []recordUpdate) (w zoneWrite, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	zf, soa, ls, err := s.loadWithStats()
+	if err != nil {
+		return
+	}
+	zoneMetrics.recordPhase(ctx, zoneName, phaseLoad, ls.read)
+	zoneMetrics.recordPhase(ctx, zoneName, phaseParse, ls.parse)
+	zoneMetrics.recordFileSize(ctx, zoneName, ls.size)
+	err = checkIfVersion(ctx, zoneVersion(s.loaded))
+	if err != nil {
+		return
+	}
 
-		lg.DebugContext(ctx, "No matching record not found, but inserting to the end")
-		newEntries = append(newEntries, values...)
+	// 1. Apply updates one by one, so later ones see results of previous
+	w.oldEntries = zf.Entries()
+	w.newEntries = w.oldEntries
+	matchedCount := 0
+	for _, u := range updates {
+		var matched int
+		w.newEntries, matched, err = applyRecordUpdate(ctx, lg, w.newEntries, u)
+		if err != nil {
+			return w, err
+		}
+		matchedCount += matched
 	}
-	span.SetAttributes(attribute.Int("zone.result_entry_count", len(newEntries)))
+	span.SetAttributes(
+		attribute.Int("zone.old_entry_count", len(w.oldEntries)),
+		attribute.Int("zone.matched_entry_count", matchedCount),
+		attribute.Int("zone.result_entry_count", len(w.newEntries)),
+	)
 
-	// 3. Check if it is changed
-	changed = !slices.EqualFunc(oldEntries, newEntries, func(e1, e2 zonefile.Entry) bool {
+	// 2. Check if it is changed
+	w.changed = !slices.EqualFunc(w.oldEntries, w.newEntries, func(e1, e2 zonefile.Entry) bool {
 		return e1.Equal(e2)
 	})
 
-	if !changed {
-		lg.InfoContext(ctx, "No records changed", "changed", changed)
+	if !w.changed {
+		lg.InfoContext(ctx, "No records changed", "changed", w.changed)
 		return
 	}
 
-	// 4. Update file
+	// 3. Update file
+	start := time.Now()
 	uglyBuf := bytes.NewBuffer(nil)
-	PrintEntries(newEntries, uglyBuf)
+	PrintEntries(w.newEntries, uglyBuf)
 
 	// fmt.Println(string(uglyBuf.String()))
 
+	now := time.Now()
+	w.oldSerial = soaSerial(soa)
+	w.newSerial = nextSerial(s.serialPolicy, w.oldSerial, now)
+
 	ret := bytes.NewBuffer(nil)
-	err = dnsfmt.Reformat(uglyBuf.Bytes(), nil, ret, true)
+	err = dnsfmt.ReformatSerial(uglyBuf.Bytes(), nil, ret, func(v []byte) []byte {
+		return nextSerial(s.serialPolicy, v, now)
+	})
+	if err != nil {
+		return
+	}
+	zoneMetrics.recordPhase(ctx, zoneName, phaseFormat, time.Since(start))
+
+	// someone may have edited the file after load, e.g. in an editor ignoring the lock
+	if s.beforeVersionCheck != nil {
+		s.beforeVersionCheck()
+	}
+	err = fileutil.CheckVersion(s.path, s.loaded)
 	if err != nil {
 		return
 	}
 
+	start = time.Now()
 	err = fileutil.AtomicWriteFile(s.path, ret.Bytes())
 	if err != nil {
-		lg.ErrorContext(ctx, "Failed to save file", "error", err, "changed", changed)
+		lg.ErrorContext(ctx, "Failed to save file", "error", err, "changed", w.changed)
 		return
 	}
+	zoneMetrics.recordPhase(ctx, zoneName, phaseWrite, time.Since(start))
 
-	lg.InfoContext(ctx, "File saved", "changed", changed)
-	return
+	return w, nil
+}
+
+// applyRecordUpdate returns a copy of entries with the update applied.
+func applyRecordUpdate(ctx context.Context, lg1 *slog.Logger, entries []zonefile.Entry, u recordUpdate) (newEntries []zonefile.Entry, matchedCount int, err error) {
+	lg := lg1.With("matchers", u.Matchers)
+
+	if u.TTL > 0 && u.Anchor != nil {
+		if err := checkTTL(entries, u.Anchor, u.TTL); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// 1. Copy all non-matching elements, insert new values on the place of first element
+	newEntries = make([]zonefile.Entry, 0, len(entries)+len(u.Values))
+	found := false
+	for idx, ent := range entries {
+		if u.Matchers.Match(ent) {
+			matchedCount++
+			if !found {
+				lg.DebugContext(ctx, "First matching record found", "index", idx, "old_values", ent.ValuesStrings())
+				newEntries = append(newEntries, u.Values...)
+				found = true
+			} else {
+				lg.DebugContext(ctx, "Remove matching record", "index", idx, "old_values", ent.ValuesStrings())
+			}
+			continue
+		}
+
+		newEntries = append(newEntries, ent)
+	}
+
+	if found {
+		return newEntries, matchedCount, nil
+	}
+
+	// 2. If old record not found - add new values after the anchor or to the end, if allowed
+	if !u.AllowNew {
+		lg.ErrorContext(ctx, "No matching record not found, but insert is not allowed.")
+		return nil, 0, ErrRecordNotFound
+	}
+
+	if u.Anchor != nil {
+		for idx := len(newEntries) - 1; idx >= 0; idx-- {
+			if u.Anchor.Match(newEntries[idx]) {
+				lg.DebugContext(ctx, "No matching record not found, inserting after anchor", "index", idx)
+				return slices.Insert(newEntries, idx+1, u.Values...), 0, nil
+			}
+		}
+	}
+
+	lg.DebugContext(ctx, "No matching record not found, but inserting to the end")
+	return append(newEntries, u.Values...), 0, nil
+}
+
+// checkTTL returns ErrTTLMismatch if any entry matching the matchers has another TTL.
+// Entries without TTL have the one of the last $TTL before them.
+func checkTTL(entries []zonefile.Entry, matchers Matchers, ttl int) error {
+	currentTTL := 0
+	for _, ent := range entries {
+		if ent.IsControl {
+			if bytes.Equal(ent.Command(), []byte("$TTL")) && len(ent.Values()) > 0 {
+				if v, ok := zonefile.StringToTTL(string(ent.Values()[0])); ok {
+					currentTTL = int(v)
+				}
+			}
+			continue
+		}
+
+		if !matchers.Match(ent) {
+			continue
+		}
+
+		if ent.IsComment {
+			ent, _ = parseDisabledEntry(ent)
+		}
+
+		entTTL := currentTTL
+		if v := ent.TTL(); v != nil {
+			entTTL = *v
+		}
+		if entTTL != ttl {
+			return fmt.Errorf("%w: %d, rrset has %d", ErrTTLMismatch, ttl, entTTL)
+		}
+	}
+
+	return nil
 }
 
-func (s *File) UpdateDDNSAddress(ctx context.Context, domain string, addrs []netip.Addr) error {
+func (s *File) UpdateDDNSAddress(ctx context.Context, domain string, addrs []netip.Addr) (err error) {
 	ctx, span := zoneTracer.Start(ctx, "zone.file.update_ddns_address")
 	span.SetAttributes(
 		attribute.String("zone.file", path.Base(s.path)),
@@ -455,9 +884,19 @@ func (s *File) UpdateDDNSAddress(ctx context.Context, domain string, addrs []net
 	)
 	defer span.End()
 
+	changed := false
+	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpDDNS, changed, err)
+	}()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkUpdate(OpDDNS); err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
 	lg := s.lg.With("domain", domain, "new_addrs", addrs)
 
 	slices.SortFunc(addrs, func(a, b netip.Addr) int {
@@ -482,10 +921,10 @@ func (s *File) UpdateDDNSAddress(ctx context.Context, domain string, addrs []net
 	newentbuf := bytes.NewBuffer(nil)
 
 	for _, addr := range newA {
-		_, _ = fmt.Fprintf(newentbuf, "\n%s IN A %v\n", shortDomain, addr)
+		_, _ = fmt.Fprintf(newentbuf, "\n%s%s IN A %v\n", shortDomain, ttlField(s.defaultTTL), addr)
 	}
 	for _, addr := range newAAAA {
-		_, _ = fmt.Fprintf(newentbuf, "\n%s IN AAAA %v\n", shortDomain, addr)
+		_, _ = fmt.Fprintf(newentbuf, "\n%s%s IN AAAA %v\n", shortDomain, ttlField(s.defaultTTL), addr)
 	}
 
 	values, err := parseEntries(newentbuf)
@@ -502,7 +941,7 @@ func (s *File) UpdateDDNSAddress(ctx context.Context, domain string, addrs []net
 		matchers = append(matchers, Matcher{Domain: shortDomain, RRType: dns.TypeAAAA})
 	}
 
-	_, err = s.updateRecords(ctx, lg, matchers, values, true)
+	changed, err = s.updateRecords(ctx, lg, OpDDNS, matchers, values, true)
 	if err != nil {
 		recordSpanError(span, err)
 		return err
@@ -519,7 +958,9 @@ func (s *File) UpdateACMEChallenge(ctx context.Context, domain string, newToken,
 		attribute.Bool("zone.old_token_provided", oldToken != ""),
 		attribute.Bool("zone.new_token_empty", newToken == ""),
 	)
+	changed := false
 	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpACME, changed, err)
 		recordSpanError(span, err)
 		span.End()
 	}()
@@ -527,6 +968,10 @@ func (s *File) UpdateACMEChallenge(ctx context.Context, domain string, newToken,
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkUpdate(OpACME); err != nil {
+		return err
+	}
+
 	lg := s.lg.With("domain", domain, "old_token", oldToken, "new_token", newToken)
 	if newToken == "" {
 		lg.Warn("Use placeholder for empty TXT record")
@@ -535,13 +980,14 @@ func (s *File) UpdateACMEChallenge(ctx context.Context, domain string, newToken,
 
 	shortDomain := []byte(StripOrigin(domain, s.origin))
 
-	newentbuf := bytes.NewBuffer(nil)
-	if s.acmeTTL > 0 {
-		_, _ = fmt.Fprintf(newentbuf, "\n%s %d IN TXT %v\n", shortDomain, s.acmeTTL, quoteTXT(newToken))
-	} else {
-		_, _ = fmt.Fprintf(newentbuf, "\n%s IN TXT %v\n", shortDomain, quoteTXT(newToken))
+	ttl := s.acmeTTL
+	if ttl == 0 {
+		ttl = s.defaultTTL
 	}
 
+	newentbuf := bytes.NewBuffer(nil)
+	_, _ = fmt.Fprintf(newentbuf, "\n%s%s IN TXT %v\n", shortDomain, ttlField(ttl), quoteTXT(newToken))
+
 	values, err := parseEntries(newentbuf)
 	if err != nil {
 		return err
@@ -562,7 +1008,7 @@ func (s *File) UpdateACMEChallenge(ctx context.Context, domain string, newToken,
 		},
 	}
 
-	_, err = s.updateRecords(ctx, lg, matchers, values, true)
+	changed, err = s.updateRecords(ctx, lg, OpACME, matchers, values, true)
 	if err != nil {
 		return err
 	}
@@ -579,6 +1025,7 @@ func (s *File) ZMUpdateRecord(ctx context.Context, domain string, typ string, tt
 		attribute.Int("zone.value_count", len(newValues)),
 	)
 	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpZM, changed, err)
 		span.SetAttributes(attribute.Bool("zone.changed", changed))
 		recordSpanError(span, err)
 		span.End()
@@ -587,6 +1034,10 @@ func (s *File) ZMUpdateRecord(ctx context.Context, domain string, typ string, tt
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkUpdate(OpZM); err != nil {
+		return false, err
+	}
+
 	lg := s.lg.With("domain", domain, "new_values", newValues)
 
 	typ = strings.ToUpper(strings.TrimSpace(typ))
@@ -598,12 +1049,11 @@ func (s *File) ZMUpdateRecord(ctx context.Context, domain string, typ string, tt
 	shortDomain := []byte(StripOrigin(domain, s.origin))
 	newentbuf := bytes.NewBuffer(nil)
 
+	if ttl == 0 {
+		ttl = s.defaultTTL
+	}
 	for _, val := range newValues {
-		if ttl > 0 {
-			_, _ = fmt.Fprintf(newentbuf, "\n%s %d IN %s %s\n", shortDomain, ttl, typ, val)
-		} else {
-			_, _ = fmt.Fprintf(newentbuf, "\n%s IN %s %s\n", shortDomain, typ, val)
-		}
+		_, _ = fmt.Fprintf(newentbuf, "\n%s%s IN %s %s\n", shortDomain, ttlField(ttl), typ, val)
 	}
 
 	values, err := parseEntries(newentbuf)
@@ -618,7 +1068,7 @@ func (s *File) ZMUpdateRecord(ctx context.Context, domain string, typ string, tt
 		},
 	}
 
-	return s.updateRecords(ctx, lg, matchers, values, false)
+	return s.updateRecords(ctx, lg, OpZM, matchers, values, false)
 }
 
 func StripOrigin(name, origin string) string {
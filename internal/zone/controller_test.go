@@ -35,6 +35,15 @@ func TestNew_Bad(t *testing.T) {
 	assert.ErrorIs(err, ErrSoaNotFound)
 }
 
+func TestNew_DuplicateOrigin(t *testing.T) {
+	dup := filepath.Join(t.TempDir(), "db.at.example.com")
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", dup))
+
+	_, err := New("./testdata/at.example.com.zone", dup)
+	assert.ErrorIs(t, err, ErrDuplicateZone)
+	assert.ErrorContains(t, err, "origin at.example.com.")
+}
+
 func TestFile_UpdateDDNSAddress(t *testing.T) {
 
 	testv4, _ := netip.ParseAddr("1.2.3.4")
@@ -76,6 +85,25 @@ func TestFile_UpdateDDNSAddress(t *testing.T) {
 	}
 }
 
+func TestFile_UpdateDDNSAddress_InlineComment(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	buf, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	buf = append(buf, "home IN A 192.0.2.1 ; router\n"...)
+	require.NoError(t, os.WriteFile(f.path, buf, 0o600))
+
+	// same address, so the file and its serial are left alone
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	for range 2 {
+		require.NoError(t, f.UpdateDDNSAddress(context.Background(), "home", addrs))
+
+		after, err := os.ReadFile(f.path)
+		require.NoError(t, err)
+		assert.Equal(t, string(buf), string(after))
+	}
+}
+
 func TestFile_UpdateACMEChallenge(t *testing.T) {
 
 	token := "fake/XKo9kaBlVnj9q0XWAWdoSYEPCOrhiZk3ztoBHx5c3O6X"
@@ -0,0 +1,69 @@
+package zone
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vooon/zoneomatic/pkg/zonefile"
+)
+
+// DisabledPrefix marks a record which is kept in the zone file as a comment.
+// Authoritative servers ignore such lines, but Snapshot reports them as disabled records.
+//
+// Example: `;zm-disabled: www 60 IN A 192.0.2.1`
+const DisabledPrefix = ";zm-disabled:"
+
+// parseDisabledEntry returns the record hidden in a disabled-record comment.
+func parseDisabledEntry(ent zonefile.Entry) (zonefile.Entry, bool) {
+	if !ent.IsComment {
+		return zonefile.Entry{}, false
+	}
+
+	comments := ent.Comments()
+	if len(comments) != 1 {
+		return zonefile.Entry{}, false
+	}
+
+	line, ok := bytes.CutPrefix(comments[0], []byte(DisabledPrefix))
+	if !ok {
+		return zonefile.Entry{}, false
+	}
+
+	zf, err := zonefile.Load(slices.Concat(bytes.TrimSpace(line), []byte("\n")))
+	if err != nil || len(zf.Entries()) != 1 {
+		return zonefile.Entry{}, false
+	}
+
+	rec := zf.Entries()[0]
+	if rec.IsComment || rec.IsControl || rec.Domain() == nil || rec.RRType() == 0 {
+		return zonefile.Entry{}, false
+	}
+
+	return rec, true
+}
+
+// disabledEntry builds a disabled-record comment entry.
+func disabledEntry(shortName string, ttl int, typ, value string) (zonefile.Entry, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return zonefile.Entry{}, fmt.Errorf("invalid disabled record: %q", value)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, _ = fmt.Fprintf(buf, "%s %s %d IN %s %s\n", DisabledPrefix, shortName, ttl, typ, value)
+
+	entries, err := parseEntries(buf)
+	if err != nil {
+		return zonefile.Entry{}, err
+	}
+
+	if len(entries) != 1 {
+		return zonefile.Entry{}, fmt.Errorf("invalid disabled record: %q", value)
+	}
+	if _, ok := parseDisabledEntry(entries[0]); !ok {
+		return zonefile.Entry{}, fmt.Errorf("invalid disabled record: %q", value)
+	}
+
+	return entries[0], nil
+}
@@ -0,0 +1,241 @@
+package zone
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/vooon/zoneomatic/internal/audit"
+)
+
+const (
+	gitTimeout = 30 * time.Second
+	// gitAnonymousAuthor is the author of changes without identity
+	gitAnonymousAuthor = "zoneomatic"
+)
+
+// Git operations reported by zone metrics
+const (
+	gitOpCommit = "commit"
+	gitOpPush   = "push"
+)
+
+// GitConfig enables commits of zone changes to the git repository of the zone file.
+//
+// The committer comes from git config (user.name, user.email), the author is the authenticated user.
+type GitConfig struct {
+	// Remote, if set, is pushed to in background after commits
+	Remote string
+	// AuthorDomain makes author emails user@AuthorDomain, emails are empty otherwise
+	AuthorDomain string
+}
+
+// WithGitCommit commits every zone change to the git repository containing the zone file.
+// Zone files outside of a git repository fail to load.
+func WithGitCommit(cfg GitConfig) Option {
+	return func(d *DomainCtrl) {
+		d.git = &cfg
+	}
+}
+
+// gitRepo is shared by zones in the same repository.
+type gitRepo struct {
+	root string
+	cfg  GitConfig
+	// mu serializes git commands, they fight over index.lock otherwise
+	mu     sync.Mutex
+	pushCh chan struct{}
+}
+
+// gitRepo returns the repository of the zone file.
+// Must be called from the constructor or Reload.
+func (dc *DomainCtrl) gitRepo(filename string) (*gitRepo, error) {
+	out, err := runGit(context.Background(), filepath.Dir(filename), nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.TrimSpace(string(out))
+	if r, ok := dc.repos[root]; ok {
+		return r, nil
+	}
+
+	r := &gitRepo{root: root, cfg: *dc.git}
+	if r.cfg.Remote != "" {
+		r.pushCh = make(chan struct{}, 1)
+		go r.pushLoop()
+	}
+
+	if dc.repos == nil {
+		dc.repos = make(map[string]*gitRepo)
+	}
+	dc.repos[root] = r
+
+	return r, nil
+}
+
+// gitCommit commits the zone file, failures are logged.
+// Must be called with s.mu held.
+func (s *File) gitCommit(ctx context.Context, lg *slog.Logger, op string, entries []audit.Entry, serial string) {
+	if s.git == nil {
+		return
+	}
+
+	ctx, span := zoneTracer.Start(ctx, "zone.file.git_commit")
+	span.SetAttributes(attribute.String("zone.file", path.Base(s.path)))
+	defer span.End()
+
+	err := s.git.commit(ctx, s.path, gitAuthor(ctx, s.git.cfg.AuthorDomain), gitMessage(op, normalizeZoneName(s.origin), entries, serial))
+	zoneMetrics.recordGit(ctx, gitOpCommit, err)
+	if err != nil {
+		recordSpanError(span, err)
+		lg.ErrorContext(ctx, "Failed to commit zone change", "repo", s.git.root, "error", err)
+		return
+	}
+
+	lg.DebugContext(ctx, "Zone change committed", "repo", s.git.root)
+	s.git.requestPush()
+}
+
+func (r *gitRepo) commit(ctx context.Context, filename string, author []string, msg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the change is saved, do not stop if the client goes away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gitTimeout)
+	defer cancel()
+
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runGit(ctx, r.root, nil, "add", "--", filename); err != nil {
+		return err
+	}
+
+	// only the zone file, other staged changes are left alone
+	_, err = runGit(ctx, r.root, author, "commit", "--quiet", "--no-verify", "--message", msg, "--", filename)
+	return err
+}
+
+// ignored checks if the file is ignored in the repository, it does not need to exist.
+func (r *gitRepo) ignored(filename string) (bool, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = runGit(context.Background(), r.root, nil, "check-ignore", "--quiet", "--", filename)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// requestPush wakes the push loop, pushes requested while pushing are coalesced.
+func (r *gitRepo) requestPush() {
+	if r.pushCh == nil {
+		return
+	}
+
+	select {
+	case r.pushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *gitRepo) pushLoop() {
+	lg := slog.Default().With("repo", r.root, "remote", r.cfg.Remote)
+	for range r.pushCh {
+		ctx, span := zoneTracer.Start(context.Background(), "zone.git_push")
+		span.SetAttributes(attribute.String("zone.git_remote", r.cfg.Remote))
+
+		err := r.push(ctx)
+		zoneMetrics.recordGit(ctx, gitOpPush, err)
+		if err != nil {
+			recordSpanError(span, err)
+			lg.ErrorContext(ctx, "Failed to push zone changes", "error", err)
+		} else {
+			lg.DebugContext(ctx, "Zone changes pushed")
+		}
+
+		span.End()
+	}
+}
+
+func (r *gitRepo) push(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	// push does not need the index, so commits can go on meanwhile
+	_, err := runGit(ctx, r.root, nil, "push", "--quiet", r.cfg.Remote, "HEAD")
+	return err
+}
+
+// gitAuthor returns environment to set the author to the authenticated user.
+func gitAuthor(ctx context.Context, domain string) []string {
+	name := gitAnonymousAuthor
+	if actor, ok := ActorFromContext(ctx); ok && actor.User != "" {
+		name = actor.User
+	}
+
+	email := ""
+	if domain != "" {
+		email = name + "@" + domain
+	}
+
+	return []string{"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email}
+}
+
+// gitMessage describes changed RRsets, the subject names the RRset if only one changed.
+func gitMessage(op, zoneName string, entries []audit.Entry, serial string) string {
+	var b strings.Builder
+
+	switch len(entries) {
+	case 0:
+		_, _ = fmt.Fprintf(&b, "%s: update %s\n", op, zoneName)
+	case 1:
+		_, _ = fmt.Fprintf(&b, "%s: %s %s\n", op, entries[0].Name, entries[0].Type)
+	default:
+		_, _ = fmt.Fprintf(&b, "%s: update %d RRsets in %s\n\n", op, len(entries), zoneName)
+		for _, e := range entries {
+			_, _ = fmt.Fprintf(&b, "%s %s\n", e.Name, e.Type)
+		}
+	}
+
+	_, _ = fmt.Fprintf(&b, "\nZone: %s\nSerial: %s\n", zoneName, serial)
+	return b.String()
+}
+
+func runGit(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// never wait for credentials
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, env...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		out = bytes.TrimSpace(out)
+		if len(out) > maxHookOutput {
+			out = out[:maxHookOutput]
+		}
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, out)
+	}
+
+	return out, nil
+}
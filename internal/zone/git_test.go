@@ -0,0 +1,114 @@
+package zone
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fcopy "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vooon/zoneomatic/internal/audit"
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	out, err := runGit(context.Background(), dir, nil, args...)
+	require.NoError(t, err)
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestFile_GitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote.git")
+	repo := filepath.Join(tmp, "repo")
+	zoneFile := filepath.Join(repo, "zones", "at.example.com.zone")
+
+	testGit(t, tmp, "init", "--quiet", "--bare", remote)
+	testGit(t, tmp, "init", "--quiet", repo)
+	testGit(t, repo, "config", "user.name", "Zone Bot")
+	testGit(t, repo, "config", "user.email", "bot@example.net")
+	testGit(t, repo, "remote", "add", "origin", remote)
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", zoneFile))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ".gitignore"), []byte(".*.lock\n"), 0o600))
+	testGit(t, repo, "add", ".")
+	testGit(t, repo, "commit", "--quiet", "-m", "initial")
+
+	ctrl, err := NewWithConfigs([]Option{WithGitCommit(GitConfig{Remote: "origin", AuthorDomain: "example.com"})},
+		FileConfig{Path: zoneFile, SerialPolicy: SerialIncrement})
+	require.NoError(t, err)
+
+	ctx := WithActor(context.Background(), Actor{User: "router"})
+	require.NoError(t, ctrl.UpdateDDNSAddress(ctx, "new-entry.at.example.com", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	assert.Equal(t, "router <router@example.com> Zone Bot", testGit(t, repo, "log", "-1", "--format=%an <%ae> %cn"))
+	assert.Equal(t, "ddns: new-entry.at.example.com. A\n\nZone: at.example.com.\nSerial: 1763822926",
+		testGit(t, repo, "log", "-1", "--format=%B"))
+	assert.Empty(t, testGit(t, repo, "status", "--porcelain"))
+
+	head := testGit(t, repo, "rev-parse", "HEAD")
+	assert.Eventually(t, func() bool {
+		out, err := runGit(context.Background(), remote, nil, "rev-parse", "HEAD")
+		return err == nil && strings.TrimSpace(string(out)) == head
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGitRepo_Ignored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	repo := t.TempDir()
+	testGit(t, repo, "init", "--quiet", repo)
+	r := &gitRepo{root: repo}
+	lockFile := fileutil.LockPath(filepath.Join(repo, "example.com.zone"))
+
+	ignored, err := r.ignored(lockFile)
+	require.NoError(t, err)
+	assert.False(t, ignored)
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ".gitignore"), []byte(".*.lock\n"), 0o600))
+	ignored, err = r.ignored(lockFile)
+	require.NoError(t, err)
+	assert.True(t, ignored)
+}
+
+func TestNewWithConfigs_GitNoRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	// in case TMPDIR is inside a repository
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	zoneFile := filepath.Join(dir, "at.example.com.zone")
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", zoneFile))
+
+	_, err := NewWithConfigs([]Option{WithGitCommit(GitConfig{})}, FileConfig{Path: zoneFile})
+	assert.ErrorContains(t, err, "git repository of zone")
+}
+
+func TestGitMessage(t *testing.T) {
+	assert.Equal(t, "zm: update example.com.\n\nZone: example.com.\nSerial: 5\n", gitMessage(OpZM, "example.com.", nil, "5"))
+
+	entries := []audit.Entry{
+		{Name: "www.example.com.", Type: "A"},
+		{Name: "www.example.com.", Type: "AAAA"},
+	}
+	assert.Equal(t, "pdns: update 2 RRsets in example.com.\n\nwww.example.com. A\nwww.example.com. AAAA\n\nZone: example.com.\nSerial: 5\n",
+		gitMessage(OpPDNS, "example.com.", entries, "5"))
+}
@@ -0,0 +1,72 @@
+package zone
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+// ZoneStatus is a result of the zone file check.
+type ZoneStatus struct {
+	Name string
+	File string
+	// Err is nil if the zone can be updated
+	Err error
+}
+
+func (s *DomainCtrl) CheckZones(ctx context.Context) []ZoneStatus {
+	ctx, span := zoneTracer.Start(ctx, "zone.domain_ctrl.check_zones")
+	files := s.zoneFiles()
+	span.SetAttributes(attribute.Int("zone.file_count", len(files)))
+	defer span.End()
+
+	ret := make([]ZoneStatus, 0, len(files))
+	failed := 0
+	for _, fl := range files {
+		st := fl.Check(ctx)
+		if st.Err != nil {
+			failed++
+		}
+
+		ret = append(ret, st)
+	}
+
+	slices.SortFunc(ret, func(a, b ZoneStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	span.SetAttributes(attribute.Int("zone.failed_count", failed))
+
+	return ret
+}
+
+// Check verifies that the file parses, has SOA and the same origin,
+// and that its directory allows the atomic write.
+func (s *File) Check(ctx context.Context) (status ZoneStatus) {
+	ctx, span := zoneTracer.Start(ctx, "zone.file.check")
+	span.SetAttributes(attribute.String("zone.file", path.Base(s.path)))
+	defer func() {
+		recordSpanError(span, status.Err)
+		span.End()
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status = ZoneStatus{
+		Name: normalizeZoneName(s.origin),
+		File: path.Base(s.path),
+	}
+
+	if _, _, err := s.load(ctx); err != nil {
+		status.Err = err
+		return
+	}
+
+	status.Err = fileutil.CheckWritable(s.path)
+	return
+}
@@ -0,0 +1,43 @@
+package zone
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_Check(t *testing.T) {
+	ctx := context.Background()
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	st := f.Check(ctx)
+	assert.Equal(t, "at.example.com.", st.Name)
+	assert.Equal(t, "at.example.com.zone", st.File)
+	assert.NoError(t, st.Err)
+
+	buf, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(f.path, []byte(strings.Replace(string(buf), "$ORIGIN at.example.com.", "$ORIGIN other.example.com.", 1)), 0644))
+	assert.ErrorIs(t, f.Check(ctx).Err, ErrOriginChanged)
+
+	require.NoError(t, os.WriteFile(f.path, []byte("$ORIGIN at.example.com.\nwww IN A 192.0.2.1\n"), 0644))
+	assert.ErrorIs(t, f.Check(ctx).Err, ErrSoaNotFound)
+
+	require.NoError(t, os.Remove(f.path))
+	assert.ErrorIs(t, f.Check(ctx).Err, os.ErrNotExist)
+}
+
+func TestDomainCtrl_CheckZones(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+	dc := &DomainCtrl{files: []*File{f}}
+
+	st := dc.CheckZones(context.Background())
+	require.Len(t, st, 1)
+	assert.Equal(t, "at.example.com.", st[0].Name)
+	assert.NoError(t, st[0].Err)
+}
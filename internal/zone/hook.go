@@ -0,0 +1,182 @@
+package zone
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultHookTimeout = 10 * time.Second
+	notifyTimeout      = 5 * time.Second
+	// maxHookOutput limits logged output of a failed hook or git command
+	maxHookOutput = 1024
+	// maxPendingHooks limits hook runs waiting for a slow hook of the zone, further ones are dropped
+	maxPendingHooks = 16
+)
+
+// hookQueue runs the hooks of a zone in background, one run at a time.
+// The zero value is ready to use, the worker goroutine exits when the queue is empty.
+type hookQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool
+}
+
+// push queues the run, false if too many runs are pending.
+func (q *hookQueue) push(run func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) >= maxPendingHooks {
+		return false
+	}
+
+	q.pending = append(q.pending, run)
+	if !q.running {
+		q.running = true
+		go q.work()
+	}
+
+	return true
+}
+
+func (q *hookQueue) work() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+
+		run := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		run()
+	}
+}
+
+// runHooks queues the hooks to run one by one in background, so a slow hook does not hold up updates.
+// Failures are logged. Must be called with s.mu held, the run gets copies of what it needs.
+func (s *File) runHooks(ctx context.Context, lg *slog.Logger, op, serial string) {
+	if len(s.hooks) == 0 {
+		return
+	}
+
+	actor, _ := ActorFromContext(ctx)
+	env := append(os.Environ(),
+		"ZM_ZONE="+normalizeZoneName(s.origin),
+		"ZM_ZONE_FILE="+s.path,
+		"ZM_SERIAL="+serial,
+		"ZM_OPERATION="+op,
+		"ZM_USER="+actor.User,
+	)
+	hooks := s.hooks
+
+	// the change is saved, do not stop the hooks if the client goes away
+	ctx = context.WithoutCancel(ctx)
+	queued := s.hookQueue.push(func() {
+		for _, h := range hooks {
+			s.runHook(ctx, lg, h, env)
+		}
+	})
+	if !queued {
+		lg.ErrorContext(ctx, "Zone hooks skipped, too many runs pending", "serial", serial)
+	}
+}
+
+func (s *File) runHook(ctx context.Context, lg *slog.Logger, h Hook, env []string) {
+	ctx, span := zoneTracer.Start(ctx, "zone.file.hook")
+	span.SetAttributes(
+		attribute.String("zone.file", path.Base(s.path)),
+		attribute.String("zone.hook", h.Command[0]),
+	)
+	defer span.End()
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		recordSpanError(span, err)
+		out = bytes.TrimSpace(out)
+		if len(out) > maxHookOutput {
+			out = out[:maxHookOutput]
+		}
+		lg.ErrorContext(ctx, "Zone hook failed", "hook", h.Command[0], "error", err, "output", string(out))
+		return
+	}
+
+	lg.DebugContext(ctx, "Zone hook done", "hook", h.Command[0])
+}
+
+// sendNotify sends DNS NOTIFY to the targets in background.
+func (s *File) sendNotify(ctx context.Context, lg *slog.Logger) {
+	if len(s.notify) == 0 {
+		return
+	}
+
+	zoneName := normalizeZoneName(s.origin)
+	targets := s.notify
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		for _, t := range targets {
+			if err := notify(ctx, zoneName, t); err != nil {
+				lg.WarnContext(ctx, "DNS NOTIFY failed", "target", t, "error", err)
+				continue
+			}
+
+			lg.DebugContext(ctx, "DNS NOTIFY sent", "target", t)
+		}
+	}()
+}
+
+func notify(ctx context.Context, zoneName, target string) (err error) {
+	ctx, span := zoneTracer.Start(ctx, "zone.notify")
+	span.SetAttributes(
+		attribute.String("zone.name", zoneName),
+		attribute.String("zone.notify_target", target),
+	)
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	addr, err := notifyAddr(target)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetNotify(zoneName)
+
+	c := &dns.Client{Timeout: notifyTimeout}
+	resp, _, err := c.ExchangeContext(ctx, m, addr)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("notify rejected: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
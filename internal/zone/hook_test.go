@@ -0,0 +1,171 @@
+package zone
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	fcopy "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newZoneTempWithConfig(t *testing.T, file string, cfg FileConfig) *File {
+	t.Helper()
+
+	cfg.Path = path.Join(t.TempDir(), path.Base(file))
+	require.NoError(t, fcopy.Copy(file, cfg.Path))
+
+	ctrl, err := NewWithConfigs(nil, cfg)
+	require.NoError(t, err)
+
+	return ctrl.(*DomainCtrl).files[0]
+}
+
+func TestNewWithConfigs_Invalid(t *testing.T) {
+	_, err := NewWithConfigs(nil, FileConfig{Path: "./testdata/at.example.com.zone", SerialPolicy: "bad"})
+	assert.ErrorIs(t, err, ErrUnknownSerialPolicy)
+}
+
+func TestFile_Operations(t *testing.T) {
+	ctx := context.Background()
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{Operations: []string{OpACME}})
+
+	err := f.UpdateDDNSAddress(ctx, "loop", []netip.Addr{netip.MustParseAddr("192.0.2.1")})
+	assert.ErrorIs(t, err, ErrOperationNotAllowed)
+	_, err = f.ZMUpdateRecord(ctx, "loop", "A", 0, []string{"192.0.2.1"})
+	assert.ErrorIs(t, err, ErrOperationNotAllowed)
+	_, err = f.DeleteRRSet(ctx, "loop.at.example.com.", "A")
+	assert.ErrorIs(t, err, ErrOperationNotAllowed)
+
+	assert.NoError(t, f.UpdateACMEChallenge(ctx, "_acme-challenge.zot", "token", ""))
+}
+
+func TestFile_DefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{DefaultTTL: 300})
+
+	ttl := func(name, typ string) int {
+		snap, err := f.Snapshot(ctx)
+		require.NoError(t, err)
+
+		for _, rr := range snap.RRsets {
+			if rr.Name == name && rr.Type == typ {
+				return rr.TTL
+			}
+		}
+		return -1
+	}
+
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+	assert.Equal(t, 300, ttl("new-entry.at.example.com.", "A"))
+
+	_, err := f.ZMUpdateRecord(ctx, "_acme-challenge.zot", "TXT", 120, []string{`"x"`})
+	require.NoError(t, err)
+	assert.Equal(t, 120, ttl("_acme-challenge.zot.at.example.com.", "TXT"))
+
+	_, err = f.ZMUpdateRecord(ctx, "loop", "AAAA", 0, []string{"2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, 300, ttl("loop.at.example.com.", "AAAA"))
+}
+
+func TestFile_SerialPolicy(t *testing.T) {
+	ctx := context.Background()
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{SerialPolicy: SerialIncrement})
+
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	snap, err := f.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1763822926), snap.Serial)
+}
+
+func TestFile_Hooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.out")
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{
+		SerialPolicy: SerialIncrement,
+		Hooks: []Hook{
+			{Command: []string{"sh", "-c", `echo "$ZM_ZONE $ZM_SERIAL $ZM_OPERATION $ZM_USER" > "$1"`, "hook", out}},
+			{Command: []string{"false"}},
+		},
+	})
+
+	ctx := WithActor(context.Background(), Actor{User: "u"})
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	assert.Eventually(t, func() bool {
+		buf, err := os.ReadFile(out)
+		return err == nil && string(buf) == "at.example.com. 1763822926 ddns u\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFile_SlowHookDoesNotBlockUpdates(t *testing.T) {
+	dir := t.TempDir()
+	release := filepath.Join(dir, "release")
+	out := filepath.Join(dir, "hook.out")
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{
+		SerialPolicy: SerialIncrement,
+		Hooks: []Hook{
+			{Command: []string{"sh", "-c", `while [ ! -e "$1" ]; do sleep 0.01; done; echo "$ZM_SERIAL" >> "$2"`,
+				"hook", release, out}},
+		},
+	})
+
+	ctx := context.Background()
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	// the first hook run waits for the release, the second update must not wait for it
+	done := make(chan error, 1)
+	go func() {
+		done <- f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.2")})
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second update is blocked by the hook")
+	}
+
+	require.NoError(t, os.WriteFile(release, nil, 0o600))
+	assert.Eventually(t, func() bool {
+		buf, err := os.ReadFile(out)
+		return err == nil && string(buf) == "1763822926\n1763822927\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFile_Notify(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var notified []string
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Opcode == dns.OpcodeNotify && len(r.Question) == 1 {
+			mu.Lock()
+			notified = append(notified, r.Question[0].Name)
+			mu.Unlock()
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	f := newZoneTempWithConfig(t, "./testdata/at.example.com.zone", FileConfig{Notify: []string{pc.LocalAddr().String()}})
+	require.NoError(t, f.UpdateDDNSAddress(context.Background(), "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(notified) == 1 && notified[0] == "at.example.com."
+	}, 5*time.Second, 10*time.Millisecond)
+}
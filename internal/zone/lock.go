@@ -0,0 +1,69 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+const (
+	// DefaultLockTimeout is the default wait for the zone file lock
+	DefaultLockTimeout = 10 * time.Second
+	// lockWaitWarn is the lock wait long enough to be logged
+	lockWaitWarn = time.Second
+)
+
+// ErrZoneLocked emitted if another process holds the zone file lock for too long
+var ErrZoneLocked = errors.New("zone file is locked by another process")
+
+// WithLockTimeout sets the wait for the cross-process zone file lock.
+// If timeout is 0, files are not locked, only in-process updates are serialized.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(d *DomainCtrl) {
+		d.lockTimeout = timeout
+	}
+}
+
+// lock takes the cross-process lock, so dnsfmt and other instances do not clobber the change.
+// Unlock may be called more than once.
+func (s *File) lock(ctx context.Context, lg *slog.Logger) (unlock func(), err error) {
+	if s.lockTimeout == 0 {
+		return func() {}, nil
+	}
+
+	ctx, span := zoneTracer.Start(ctx, "zone.file.lock")
+	span.SetAttributes(attribute.String("zone.file", path.Base(s.path)))
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	start := time.Now()
+	funlock, err := fileutil.Lock(ctx, s.path, s.lockTimeout)
+	if errors.Is(err, fileutil.ErrLockTimeout) {
+		return nil, fmt.Errorf("%w: %s", ErrZoneLocked, path.Base(s.path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d := time.Since(start); d > lockWaitWarn {
+		lg.WarnContext(ctx, "Waited for zone file lock", "wait", d)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := funlock(); err != nil {
+				lg.ErrorContext(ctx, "Failed to unlock zone file", "error", err)
+			}
+		})
+	}, nil
+}
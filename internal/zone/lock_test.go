@@ -0,0 +1,74 @@
+package zone
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	fcopy "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+func TestFile_Lock(t *testing.T) {
+	ctx := context.Background()
+	dest := path.Join(t.TempDir(), "at.example.com.zone")
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", dest))
+
+	ctrl, err := NewWithConfigs([]Option{WithLockTimeout(50 * time.Millisecond)}, FileConfig{Path: dest})
+	require.NoError(t, err)
+
+	// e.g. dnsfmt --replace
+	unlock, err := fileutil.Lock(ctx, dest, time.Second)
+	require.NoError(t, err)
+
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	err = ctrl.UpdateDDNSAddress(ctx, "new-entry.at.example.com", addrs)
+	assert.ErrorIs(t, err, ErrZoneLocked)
+
+	require.NoError(t, unlock())
+	assert.NoError(t, ctrl.UpdateDDNSAddress(ctx, "new-entry.at.example.com", addrs))
+}
+
+func TestFile_ExternalChange(t *testing.T) {
+	ctx := context.Background()
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+
+	var edit func()
+	f.beforeVersionCheck = func() { edit() }
+
+	// a hand edit during the first attempt is kept, the update is applied on top of it
+	edits := 0
+	edit = func() {
+		if edits > 0 {
+			return
+		}
+		edits++
+
+		buf, err := os.ReadFile(f.path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(f.path, append(buf, "hand-edit IN A 192.0.2.99\n"...), 0o600))
+	}
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", addrs))
+
+	buf, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), "hand-edit")
+	assert.Contains(t, string(buf), "new-entry")
+
+	// the file keeps changing
+	edit = func() {
+		require.NoError(t, os.WriteFile(f.path, append(buf, fmt.Sprintf("; edit %d\n", edits)...), 0o600))
+		edits++
+	}
+	err = f.UpdateDDNSAddress(ctx, "other-entry", addrs)
+	assert.ErrorIs(t, err, ErrZoneConflict)
+	assert.Equal(t, 1+maxConflictRetries+1, edits)
+}
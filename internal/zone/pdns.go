@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/miekg/dns"
+	"github.com/vooon/zoneomatic/pkg/dnsfmt"
 	"github.com/vooon/zoneomatic/pkg/zonefile"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -20,6 +21,30 @@ type RRSet struct {
 	Type    string
 	TTL     int
 	Records []string
+	// DisabledRecords are kept in the zone file as DisabledPrefix comments
+	DisabledRecords []string
+}
+
+// PDNS PATCH change types
+const (
+	ChangeReplace = "REPLACE"
+	ChangeDelete  = "DELETE"
+	ChangeExtend  = "EXTEND"
+	ChangePrune   = "PRUNE"
+)
+
+// RRSetChange is a single rrset change of a PatchRRSets batch.
+//
+// REPLACE replaces the whole RRSet, DELETE removes it, EXTEND adds Records
+// and Disabled to the RRSet and PRUNE removes records with matching values.
+// EXTEND TTL must be the TTL of the existing records, see ErrTTLMismatch.
+type RRSetChange struct {
+	ChangeType string
+	Name       string
+	Type       string
+	TTL        int
+	Records    []string
+	Disabled   []string
 }
 
 type ZoneSnapshot struct {
@@ -28,15 +53,18 @@ type ZoneSnapshot struct {
 	Serial      uint32
 	RRsets      []RRSet
 	Nameservers []string
+	// Version changes with every change of the zone file, see WithIfVersion
+	Version string
 }
 
 func (s *DomainCtrl) ListZones(ctx context.Context) ([]ZoneSnapshot, error) {
 	ctx, span := zoneTracer.Start(ctx, "zone.domain_ctrl.list_zones")
-	span.SetAttributes(attribute.Int("zone.file_count", len(s.files)))
+	files := s.zoneFiles()
+	span.SetAttributes(attribute.Int("zone.file_count", len(files)))
 	defer span.End()
 
-	ret := make([]ZoneSnapshot, 0, len(s.files))
-	for _, fl := range s.files {
+	ret := make([]ZoneSnapshot, 0, len(files))
+	for _, fl := range files {
 		zoneData, err := fl.Snapshot(ctx)
 		if err != nil {
 			recordSpanError(span, err)
@@ -72,7 +100,7 @@ func (s *DomainCtrl) GetZone(ctx context.Context, zoneName string) (snapshot Zon
 	return fl.Snapshot(ctx)
 }
 
-func (s *DomainCtrl) ReplaceRRSet(ctx context.Context, zoneName, name, typ string, ttl int, values []string) (changed bool, err error) {
+func (s *DomainCtrl) ReplaceRRSet(ctx context.Context, zoneName, name, typ string, ttl int, values, disabled []string) (changed bool, err error) {
 	ctx, span := zoneTracer.Start(ctx, "zone.domain_ctrl.replace_rrset")
 	span.SetAttributes(
 		attribute.String("zone.name", zoneName),
@@ -80,6 +108,7 @@ func (s *DomainCtrl) ReplaceRRSet(ctx context.Context, zoneName, name, typ strin
 		attribute.String("dns.rr.type", typ),
 		attribute.Int("dns.rr.ttl", ttl),
 		attribute.Int("zone.value_count", len(values)),
+		attribute.Int("zone.disabled_count", len(disabled)),
 	)
 	defer func() {
 		span.SetAttributes(attribute.Bool("zone.changed", changed))
@@ -94,7 +123,7 @@ func (s *DomainCtrl) ReplaceRRSet(ctx context.Context, zoneName, name, typ strin
 	}
 
 	span.SetAttributes(attribute.String("zone.file", path.Base(fl.path)))
-	return fl.ReplaceRRSet(ctx, name, typ, ttl, values)
+	return fl.ReplaceRRSet(ctx, name, typ, ttl, values, disabled)
 }
 
 func (s *DomainCtrl) DeleteRRSet(ctx context.Context, zoneName, name, typ string) (changed bool, err error) {
@@ -120,9 +149,31 @@ func (s *DomainCtrl) DeleteRRSet(ctx context.Context, zoneName, name, typ string
 	return fl.DeleteRRSet(ctx, name, typ)
 }
 
+func (s *DomainCtrl) PatchRRSets(ctx context.Context, zoneName string, changes []RRSetChange) (changed bool, err error) {
+	ctx, span := zoneTracer.Start(ctx, "zone.domain_ctrl.patch_rrsets")
+	span.SetAttributes(
+		attribute.String("zone.name", zoneName),
+		attribute.Int("zone.change_count", len(changes)),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Bool("zone.changed", changed))
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	fl := s.findExactZoneFile(zoneName)
+	if fl == nil {
+		err = fmt.Errorf("%w: %s", ErrZoneNotFound, zoneName)
+		return false, err
+	}
+
+	span.SetAttributes(attribute.String("zone.file", path.Base(fl.path)))
+	return fl.PatchRRSets(ctx, changes)
+}
+
 func (s *DomainCtrl) findExactZoneFile(zoneName string) *File {
 	zoneName = normalizeZoneName(zoneName)
-	for _, fl := range s.files {
+	for _, fl := range s.zoneFiles() {
 		if strings.EqualFold(normalizeZoneName(fl.origin), zoneName) {
 			return fl
 		}
@@ -132,7 +183,7 @@ func (s *DomainCtrl) findExactZoneFile(zoneName string) *File {
 }
 
 func (s *File) Snapshot(ctx context.Context) (snapshot ZoneSnapshot, err error) {
-	_, span := zoneTracer.Start(ctx, "zone.file.snapshot")
+	ctx, span := zoneTracer.Start(ctx, "zone.file.snapshot")
 	span.SetAttributes(attribute.String("zone.file", path.Base(s.path)))
 	defer func() {
 		span.SetAttributes(
@@ -147,15 +198,16 @@ func (s *File) Snapshot(ctx context.Context) (snapshot ZoneSnapshot, err error)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	zf, soa, err := s.load()
+	zf, soa, err := s.load(ctx)
 	if err != nil {
 		return ZoneSnapshot{}, err
 	}
 
 	origin := normalizeZoneName(s.origin)
 	zoneData := ZoneSnapshot{
-		ID:   origin,
-		Name: origin,
+		ID:      origin,
+		Name:    origin,
+		Version: zoneVersion(s.loaded),
 	}
 
 	if soa != nil {
@@ -173,8 +225,14 @@ func (s *File) Snapshot(ctx context.Context) (snapshot ZoneSnapshot, err error)
 	rrsetOrder := make([]string, 0)
 
 	for _, ent := range zf.Entries() {
+		disabled := false
 		if ent.IsComment {
-			continue
+			rec, ok := parseDisabledEntry(ent)
+			if !ok {
+				continue
+			}
+			ent = rec
+			disabled = true
 		}
 
 		if ent.IsControl {
@@ -211,6 +269,11 @@ func (s *File) Snapshot(ctx context.Context) (snapshot ZoneSnapshot, err error)
 		}
 
 		content := entryContent(ent)
+		if disabled {
+			rrset.DisabledRecords = append(rrset.DisabledRecords, content)
+			continue
+		}
+
 		rrset.Records = append(rrset.Records, content)
 
 		if rrType == dns.TypeNS && name == origin {
@@ -226,7 +289,7 @@ func (s *File) Snapshot(ctx context.Context) (snapshot ZoneSnapshot, err error)
 	return zoneData, nil
 }
 
-func (s *File) ReplaceRRSet(ctx context.Context, name, typ string, ttl int, values []string) (changed bool, err error) {
+func (s *File) ReplaceRRSet(ctx context.Context, name, typ string, ttl int, values, disabled []string) (changed bool, err error) {
 	ctx, span := zoneTracer.Start(ctx, "zone.file.replace_rrset")
 	span.SetAttributes(
 		attribute.String("zone.file", path.Base(s.path)),
@@ -234,8 +297,10 @@ func (s *File) ReplaceRRSet(ctx context.Context, name, typ string, ttl int, valu
 		attribute.String("dns.rr.type", typ),
 		attribute.Int("dns.rr.ttl", ttl),
 		attribute.Int("zone.value_count", len(values)),
+		attribute.Int("zone.disabled_count", len(disabled)),
 	)
 	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpPDNS, changed, err)
 		span.SetAttributes(attribute.Bool("zone.changed", changed))
 		recordSpanError(span, err)
 		span.End()
@@ -244,39 +309,25 @@ func (s *File) ReplaceRRSet(ctx context.Context, name, typ string, ttl int, valu
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if ttl <= 0 {
-		return false, fmt.Errorf("invalid ttl: %d", ttl)
-	}
-
-	lg := s.lg.With("rr_name", name, "rr_type", typ, "ttl", ttl, "record_count", len(values))
-
-	typ = strings.ToUpper(strings.TrimSpace(typ))
-	rrType, ok := dns.StringToType[typ]
-	if !ok {
-		return false, fmt.Errorf("unknown rrtype: %s", typ)
-	}
-
-	shortName, err := s.relativeRecordName(name)
-	if err != nil {
+	if err := s.checkUpdate(OpPDNS); err != nil {
 		return false, err
 	}
 
-	newentbuf := bytes.NewBuffer(nil)
-	for _, val := range values {
-		_, _ = fmt.Fprintf(newentbuf, "\n%s %d IN %s %s\n", shortName, ttl, typ, formatRecordValue(rrType, val))
-	}
+	lg := s.lg.With("rr_name", name, "rr_type", typ, "ttl", ttl, "record_count", len(values), "disabled_count", len(disabled))
 
-	entries, err := parseEntries(newentbuf)
+	u, err := s.rrsetUpdate(RRSetChange{
+		ChangeType: ChangeReplace,
+		Name:       name,
+		Type:       typ,
+		TTL:        ttl,
+		Records:    values,
+		Disabled:   disabled,
+	})
 	if err != nil {
 		return false, err
 	}
 
-	matchers := []Matcher{{
-		Domain: []byte(shortName),
-		RRType: rrType,
-	}}
-
-	return s.updateRecords(ctx, lg, matchers, entries, true)
+	return s.updateRecordsBatch(ctx, lg, OpPDNS, u)
 }
 
 func (s *File) DeleteRRSet(ctx context.Context, name, typ string) (changed bool, err error) {
@@ -287,6 +338,7 @@ func (s *File) DeleteRRSet(ctx context.Context, name, typ string) (changed bool,
 		attribute.String("dns.rr.type", typ),
 	)
 	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpPDNS, changed, err)
 		span.SetAttributes(attribute.Bool("zone.changed", changed))
 		recordSpanError(span, err)
 		span.End()
@@ -295,6 +347,10 @@ func (s *File) DeleteRRSet(ctx context.Context, name, typ string) (changed bool,
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkUpdate(OpPDNS); err != nil {
+		return false, err
+	}
+
 	lg := s.lg.With("rr_name", name, "rr_type", typ)
 
 	typ = strings.ToUpper(strings.TrimSpace(typ))
@@ -309,11 +365,12 @@ func (s *File) DeleteRRSet(ctx context.Context, name, typ string) (changed bool,
 	}
 
 	matchers := []Matcher{{
-		Domain: []byte(shortName),
-		RRType: rrType,
+		Domain:   []byte(shortName),
+		RRType:   rrType,
+		Disabled: true,
 	}}
 
-	changed, err = s.updateRecords(ctx, lg, matchers, nil, false)
+	changed, err = s.updateRecords(ctx, lg, OpPDNS, matchers, nil, false)
 	if errors.Is(err, ErrRecordNotFound) {
 		return false, nil
 	}
@@ -321,6 +378,167 @@ func (s *File) DeleteRRSet(ctx context.Context, name, typ string) (changed bool,
 	return changed, err
 }
 
+func (s *File) PatchRRSets(ctx context.Context, changes []RRSetChange) (changed bool, err error) {
+	ctx, span := zoneTracer.Start(ctx, "zone.file.patch_rrsets")
+	span.SetAttributes(
+		attribute.String("zone.file", path.Base(s.path)),
+		attribute.Int("zone.change_count", len(changes)),
+	)
+	defer func() {
+		zoneMetrics.recordUpdate(ctx, normalizeZoneName(s.origin), OpPDNS, changed, err)
+		span.SetAttributes(attribute.Bool("zone.changed", changed))
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUpdate(OpPDNS); err != nil {
+		return false, err
+	}
+
+	lg := s.lg.With("change_count", len(changes))
+
+	updates := make([]recordUpdate, 0, len(changes))
+	for _, ch := range changes {
+		u, err := s.rrsetUpdate(ch)
+		if err != nil {
+			return false, fmt.Errorf("%s %s %s: %w", ch.ChangeType, ch.Name, ch.Type, err)
+		}
+
+		updates = append(updates, u)
+	}
+
+	return s.updateRecordsBatch(ctx, lg, OpPDNS, updates...)
+}
+
+// rrsetUpdate converts the change to a record update.
+// Must be called with s.mu held, as it uses s.origin.
+func (s *File) rrsetUpdate(ch RRSetChange) (recordUpdate, error) {
+	typ := strings.ToUpper(strings.TrimSpace(ch.Type))
+	rrType, ok := dns.StringToType[typ]
+	if !ok {
+		return recordUpdate{}, fmt.Errorf("unknown rrtype: %s", typ)
+	}
+
+	shortName, err := s.relativeRecordName(ch.Name)
+	if err != nil {
+		return recordUpdate{}, err
+	}
+
+	rrsetMatchers := Matchers{{
+		Domain:   []byte(shortName),
+		RRType:   rrType,
+		Disabled: true,
+	}}
+
+	switch strings.ToUpper(strings.TrimSpace(ch.ChangeType)) {
+	case ChangeDelete:
+		return recordUpdate{Matchers: rrsetMatchers, AllowNew: true}, nil
+
+	case ChangeReplace:
+		if ch.TTL <= 0 {
+			return recordUpdate{}, fmt.Errorf("invalid ttl: %d", ch.TTL)
+		}
+
+		entries, err := s.rrsetEntries(shortName, ch.TTL, typ, rrType, ch.Records, ch.Disabled)
+		if err != nil {
+			return recordUpdate{}, err
+		}
+
+		return recordUpdate{Matchers: rrsetMatchers, Values: entries, AllowNew: true}, nil
+
+	case ChangeExtend:
+		if ch.TTL <= 0 {
+			return recordUpdate{}, fmt.Errorf("invalid ttl: %d", ch.TTL)
+		}
+
+		entries, err := s.rrsetEntries(shortName, ch.TTL, typ, rrType, ch.Records, ch.Disabled)
+		if err != nil {
+			return recordUpdate{}, err
+		}
+
+		return recordUpdate{
+			Matchers: valueMatchers(entries),
+			Values:   entries,
+			AllowNew: true,
+			Anchor:   rrsetMatchers,
+			TTL:      ch.TTL,
+		}, nil
+
+	case ChangePrune:
+		entries, err := s.rrsetEntries(shortName, 0, typ, rrType, slices.Concat(ch.Records, ch.Disabled), nil)
+		if err != nil {
+			return recordUpdate{}, err
+		}
+
+		return recordUpdate{Matchers: valueMatchers(entries), AllowNew: true}, nil
+
+	default:
+		return recordUpdate{}, fmt.Errorf("%w: %s", ErrUnknownChange, ch.ChangeType)
+	}
+}
+
+// rrsetEntries builds zone entries for the rrset values.
+// Domain names in values are stripped from origin, so they compare equal to the stored ones.
+func (s *File) rrsetEntries(shortName string, ttl int, typ string, rrType uint16, values, disabled []string) ([]zonefile.Entry, error) {
+	newentbuf := bytes.NewBuffer(nil)
+	for _, val := range values {
+		if ttl > 0 {
+			_, _ = fmt.Fprintf(newentbuf, "\n%s %d IN %s %s\n", shortName, ttl, typ, formatRecordValue(rrType, val))
+		} else {
+			_, _ = fmt.Fprintf(newentbuf, "\n%s IN %s %s\n", shortName, typ, formatRecordValue(rrType, val))
+		}
+	}
+
+	entries, err := parseEntries(newentbuf)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if err := dnsfmt.StripValuesOrigin([]byte(s.origin), &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, val := range disabled {
+		ent, err := disabledEntry(shortName, ttl, typ, formatRecordValue(rrType, val))
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, ent)
+	}
+
+	return entries, nil
+}
+
+// valueMatchers returns matchers for records with the same values as entries,
+// including disabled ones.
+func valueMatchers(entries []zonefile.Entry) Matchers {
+	matchers := make(Matchers, 0, len(entries))
+	for _, ent := range entries {
+		if ent.IsComment {
+			rec, ok := parseDisabledEntry(ent)
+			if !ok {
+				continue
+			}
+			ent = rec
+		}
+
+		matchers = append(matchers, Matcher{
+			Domain:   ent.Domain(),
+			RRType:   ent.RRType(),
+			Values:   ent.Values(),
+			Disabled: true,
+		})
+	}
+
+	return matchers
+}
+
 func (s *File) relativeRecordName(name string) (string, error) {
 	name = normalizeZoneName(name)
 	if !domainMatchesOrigin(name, s.origin) {
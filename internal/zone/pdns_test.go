@@ -2,6 +2,7 @@ package zone
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,7 +30,7 @@ func TestFile_Snapshot(t *testing.T) {
 func TestFile_ReplaceRRSet(t *testing.T) {
 	f := newZoneTemp(t, "./testdata/at.example.com.zone")
 
-	changed, err := f.ReplaceRRSet(context.Background(), "new-entry.at.example.com.", "A", 120, []string{"1.2.3.4"})
+	changed, err := f.ReplaceRRSet(context.Background(), "new-entry.at.example.com.", "A", 120, []string{"1.2.3.4"}, nil)
 	require.NoError(t, err)
 	assert.True(t, changed)
 
@@ -43,7 +44,7 @@ func TestFile_ReplaceRRSet(t *testing.T) {
 func TestFile_ReplaceRRSet_CaseInsensitiveName(t *testing.T) {
 	f := newZoneTemp(t, "./testdata/at.example.com.zone")
 
-	changed, err := f.ReplaceRRSet(context.Background(), "LOOP.at.example.com.", "A", 60, []string{"127.0.0.1"})
+	changed, err := f.ReplaceRRSet(context.Background(), "LOOP.at.example.com.", "A", 60, []string{"127.0.0.1"}, nil)
 	require.NoError(t, err)
 	assert.True(t, changed)
 
@@ -52,6 +53,65 @@ func TestFile_ReplaceRRSet_CaseInsensitiveName(t *testing.T) {
 	assert.Equal(t, 1, countRRSet(snapshot.RRsets, "loop.at.example.com.", "A"))
 }
 
+func TestFile_ReplaceRRSet_Disabled(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	changed, err := f.ReplaceRRSet(context.Background(), "loop.at.example.com.", "A", 60, nil, []string{"127.0.0.1"})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	buf, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), DisabledPrefix+" loop 60 IN A 127.0.0.1\n")
+
+	snapshot, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	rrset := findRRSet(t, snapshot.RRsets, "loop.at.example.com.", "A")
+	assert.Equal(t, 60, rrset.TTL)
+	assert.Empty(t, rrset.Records)
+	assert.Equal(t, []string{"127.0.0.1"}, rrset.DisabledRecords)
+
+	changed, err = f.ReplaceRRSet(context.Background(), "loop.at.example.com.", "A", 60, nil, []string{"127.0.0.1"})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = f.ReplaceRRSet(context.Background(), "loop.at.example.com.", "A", 60, []string{"127.0.0.1"}, nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	snapshot, err = f.Snapshot(context.Background())
+	require.NoError(t, err)
+	rrset = findRRSet(t, snapshot.RRsets, "loop.at.example.com.", "A")
+	assert.Equal(t, []string{"127.0.0.1"}, rrset.Records)
+	assert.Empty(t, rrset.DisabledRecords)
+
+	buf, err = os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), DisabledPrefix)
+}
+
+func TestFile_ReplaceRRSet_DisabledRejectsNewline(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	_, err := f.ReplaceRRSet(context.Background(), "loop.at.example.com.", "TXT", 60, nil, []string{"foo\nevil IN A 192.0.2.1"})
+	assert.Error(t, err)
+}
+
+func TestFile_DeleteRRSet_Disabled(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	_, err := f.ReplaceRRSet(context.Background(), "www.at.example.com.", "TXT", 60, []string{"on"}, []string{"off"})
+	require.NoError(t, err)
+
+	changed, err := f.DeleteRRSet(context.Background(), "www.at.example.com.", "TXT")
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	snapshot, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.False(t, hasRRSet(snapshot.RRsets, "www.at.example.com.", "TXT"))
+}
+
 func TestFile_DeleteRRSet(t *testing.T) {
 	f := newZoneTemp(t, "./testdata/at.example.com.zone")
 
@@ -80,6 +140,118 @@ func TestFile_DeleteRRSet_CaseInsensitiveName(t *testing.T) {
 	assert.False(t, hasRRSet(snapshot.RRsets, "loop.at.example.com.", "AAAA"))
 }
 
+func TestFile_PatchRRSets_ExtendPrune(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	changed, err := f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "A", TTL: 60, Records: []string{"127.0.0.2"}},
+		{ChangeType: ChangeExtend, Name: "mx.at.example.com.", Type: "MX", TTL: 60, Records: []string{"10 mail.at.example.com."}},
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	snapshot, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, findRRSet(t, snapshot.RRsets, "loop.at.example.com.", "A").Records)
+	assert.Equal(t, []string{"10 mail"}, findRRSet(t, snapshot.RRsets, "mx.at.example.com.", "MX").Records)
+
+	// extending with existing values is a no-op
+	changed, err = f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "A", TTL: 60, Records: []string{"127.0.0.2"}},
+	})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangePrune, Name: "loop.at.example.com.", Type: "A", Records: []string{"127.0.0.1", "192.0.2.1"}},
+		{ChangeType: ChangePrune, Name: "mx.at.example.com.", Type: "MX", Records: []string{"10 mail.at.example.com."}},
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	snapshot, err = f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, findRRSet(t, snapshot.RRsets, "loop.at.example.com.", "A").Records)
+	assert.Equal(t, []string{"::1"}, findRRSet(t, snapshot.RRsets, "loop.at.example.com.", "AAAA").Records)
+	assert.False(t, hasRRSet(snapshot.RRsets, "mx.at.example.com.", "MX"))
+}
+
+func TestFile_PatchRRSets_ExtendTTLMismatch(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	before, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+
+	// loop A has the zone $TTL 60
+	_, err = f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "A", TTL: 300, Records: []string{"127.0.0.2"}},
+	})
+	assert.ErrorIs(t, err, ErrTTLMismatch)
+
+	_, err = f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "A", TTL: 300, Disabled: []string{"127.0.0.1"}},
+	})
+	assert.ErrorIs(t, err, ErrTTLMismatch)
+
+	after, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	// new rrsets take any TTL
+	changed, err := f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "new.at.example.com.", Type: "A", TTL: 300, Records: []string{"192.0.2.1"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	snapshot, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 300, findRRSet(t, snapshot.RRsets, "new.at.example.com.", "A").TTL)
+}
+
+func TestFile_PatchRRSets_Atomic(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+
+	before, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+
+	_, err = f.PatchRRSets(context.Background(), []RRSetChange{
+		{ChangeType: ChangeDelete, Name: "loop.at.example.com.", Type: "A"},
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "BOGUS", TTL: 60, Records: []string{"x"}},
+	})
+	assert.Error(t, err)
+
+	after, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
+
+func TestFile_PatchRRSets_IfVersion(t *testing.T) {
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+	change := []RRSetChange{
+		{ChangeType: ChangeExtend, Name: "loop.at.example.com.", Type: "A", TTL: 60, Records: []string{"127.0.0.2"}},
+	}
+
+	before, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, before.Version, 32)
+
+	_, err = f.PatchRRSets(WithIfVersion(context.Background(), "0123456789abcdef0123456789abcdef"), change)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	changed, err := f.PatchRRSets(WithIfVersion(context.Background(), "0123456789abcdef0123456789abcdef", before.Version), change)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	after, err := f.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, before.Version, after.Version)
+
+	// the check also applies if nothing would change
+	_, err = f.PatchRRSets(WithIfVersion(context.Background(), before.Version), change)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+}
+
 func findRRSet(t *testing.T, rrsets []RRSet, name, typ string) RRSet {
 	t.Helper()
 	for _, rrset := range rrsets {
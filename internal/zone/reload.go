@@ -0,0 +1,106 @@
+package zone
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/vooon/zoneomatic/internal/stats"
+)
+
+// Reload replaces the zone list and per-zone settings.
+//
+// Files which stay keep their File, so updates waiting on the lock proceed with new settings.
+// Removed files are dropped after their in-flight updates finish.
+// If any new file fails to load, the current state is kept.
+func (s *DomainCtrl) Reload(ctx context.Context, zones ...FileConfig) (err error) {
+	ctx, span := zoneTracer.Start(ctx, "zone.domain_ctrl.reload")
+	span.SetAttributes(attribute.Int("zone.file_count", len(zones)))
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := make(map[string]*File)
+	for _, f := range s.zoneFiles() {
+		current[filepath.Clean(f.path)] = f
+	}
+
+	files := make([]*File, 0, len(zones))
+	kept := make(map[*File]FileConfig)
+	var added []string
+	for _, zc := range zones {
+		if f, ok := current[filepath.Clean(zc.Path)]; ok {
+			if err := zc.Validate(); err != nil {
+				return err
+			}
+
+			files = append(files, f)
+			kept[f] = zc
+			continue
+		}
+
+		f, err := s.newFile(zc)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		added = append(added, path.Base(f.path))
+	}
+
+	if err := checkDuplicateFiles(files); err != nil {
+		return err
+	}
+
+	for f, zc := range kept {
+		f.mu.Lock()
+		f.configure(zc, s.acmeTTL)
+		f.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.mu.Unlock()
+
+	origins := make(map[string]bool, len(files))
+	for _, f := range files {
+		origins[normalizeZoneName(f.origin)] = true
+	}
+
+	var removed []string
+	for key, f := range current {
+		if _, ok := kept[f]; ok {
+			continue
+		}
+
+		// wait for in-flight updates, later ones get ErrZoneNotFound
+		f.mu.Lock()
+		f.removed = true
+		f.mu.Unlock()
+
+		// the zone may be served from another file now
+		if name := normalizeZoneName(f.origin); !origins[name] {
+			stats.Default.RemoveZone(name)
+		}
+
+		removed = append(removed, path.Base(key))
+	}
+
+	slices.Sort(removed)
+
+	span.SetAttributes(
+		attribute.Int("zone.added_count", len(added)),
+		attribute.Int("zone.removed_count", len(removed)),
+	)
+	slog.InfoContext(ctx, "Zones reloaded", "added", added, "removed", removed, "kept", len(kept))
+
+	return nil
+}
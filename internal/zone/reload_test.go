@@ -0,0 +1,74 @@
+package zone
+
+import (
+	"context"
+	"net/netip"
+	"path"
+	"testing"
+
+	fcopy "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vooon/zoneomatic/internal/stats"
+)
+
+func TestDomainCtrl_Reload(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	at := path.Join(tmp, "at.example.com.zone")
+	mx := path.Join(tmp, "mx.example.com.zone")
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", at))
+	require.NoError(t, fcopy.Copy("./testdata/mx.example.com.zone", mx))
+
+	ctrl, err := NewWithConfigs(nil, FileConfig{Path: at})
+	require.NoError(t, err)
+	dc := ctrl.(*DomainCtrl)
+	atFile := dc.files[0]
+
+	// add a zone and change settings of the kept one
+	require.NoError(t, dc.Reload(ctx, FileConfig{Path: at, Operations: []string{OpACME}}, FileConfig{Path: mx}))
+	require.Len(t, dc.files, 2)
+	assert.Same(t, atFile, dc.files[0])
+	assert.ErrorIs(t, ctrl.UpdateDDNSAddress(ctx, "loop.at.example.com", []netip.Addr{netip.MustParseAddr("192.0.2.1")}), ErrOperationNotAllowed)
+	assert.NoError(t, ctrl.UpdateDDNSAddress(ctx, "new.mx.example.com", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+
+	// failed load keeps the state
+	err = dc.Reload(ctx, FileConfig{Path: mx}, FileConfig{Path: "./testdata/bad_no_soa.zone"})
+	assert.ErrorIs(t, err, ErrSoaNotFound)
+	assert.Len(t, dc.files, 2)
+
+	err = dc.Reload(ctx, FileConfig{Path: mx}, FileConfig{Path: mx})
+	assert.ErrorIs(t, err, ErrDuplicateZone)
+	assert.Len(t, dc.files, 2)
+
+	// drop a zone, its File rejects late updates
+	assert.Contains(t, stats.Default.Snapshot().Zones, "at.example.com.")
+	require.NoError(t, dc.Reload(ctx, FileConfig{Path: mx}))
+	require.Len(t, dc.files, 1)
+	assert.ErrorIs(t, ctrl.UpdateACMEChallenge(ctx, "at.example.com", "token", ""), ErrZoneNotFound)
+	assert.ErrorIs(t, atFile.UpdateACMEChallenge(ctx, "_acme-challenge.at.example.com.", "token", ""), ErrZoneNotFound)
+
+	// and is not reported anymore
+	snap := stats.Default.Snapshot()
+	assert.NotContains(t, snap.Zones, "at.example.com.")
+	assert.NotContains(t, snap.Serials, "at.example.com.")
+	assert.NotContains(t, snap.LastWrite, "at.example.com.")
+	assert.Contains(t, snap.Zones, "mx.example.com.")
+}
+
+func TestDomainCtrl_Reload_MovedZone(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	at := path.Join(tmp, "at.example.com.zone")
+	moved := path.Join(tmp, "db.at.example.com")
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", at))
+	require.NoError(t, fcopy.Copy("./testdata/at.example.com.zone", moved))
+
+	ctrl, err := NewWithConfigs(nil, FileConfig{Path: at})
+	require.NoError(t, err)
+
+	// the zone is served from another file, its stats stay
+	require.NoError(t, ctrl.Reload(ctx, FileConfig{Path: moved}))
+	assert.Contains(t, stats.Default.Snapshot().Zones, "at.example.com.")
+}
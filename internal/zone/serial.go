@@ -0,0 +1,68 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/vooon/zoneomatic/pkg/dnsfmt"
+)
+
+// SOA serial policies
+const (
+	// SerialAuto keeps epoch serials as epoch and increments others, as dnsfmt does
+	SerialAuto = "auto"
+	// SerialIncrement adds one
+	SerialIncrement = "increment"
+	// SerialEpoch sets the current unix time
+	SerialEpoch = "epoch"
+	// SerialDate sets YYYYMMDDnn of the current UTC date
+	SerialDate = "date"
+)
+
+var ErrUnknownSerialPolicy = errors.New("unknown serial policy")
+
+// SerialPolicies lists supported serial policies.
+var SerialPolicies = []string{SerialAuto, SerialIncrement, SerialEpoch, SerialDate}
+
+// CheckSerialPolicy returns an error for unknown policies, empty means SerialAuto.
+func CheckSerialPolicy(policy string) error {
+	switch policy {
+	case "", SerialAuto, SerialIncrement, SerialEpoch, SerialDate:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownSerialPolicy, policy)
+}
+
+// nextSerial returns the serial after old by the policy.
+// The result is always greater than old, so secondaries see the change.
+// Non-numeric serials are returned unchanged.
+func nextSerial(policy string, old []byte, now time.Time) []byte {
+	if policy == "" || policy == SerialAuto {
+		return dnsfmt.Increase(old)
+	}
+
+	n, err := strconv.ParseUint(string(old), 10, 32)
+	if err != nil {
+		return old
+	}
+
+	next := n + 1
+	switch policy {
+	case SerialEpoch:
+		next = max(next, uint64(now.Unix()))
+	case SerialDate:
+		y, m, d := now.UTC().Date()
+		next = max(next, uint64(y*1000000+int(m)*10000+d*100))
+	}
+
+	if next > math.MaxUint32 {
+		// RFC 1982 wraps around, skipping 0 which some tools treat as unset
+		next = 1
+	}
+
+	return []byte(strconv.FormatUint(next, 10))
+}
@@ -1,13 +1,120 @@
 package zone
 
 import (
+	"context"
+	"time"
+
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var zoneTracer = otel.Tracer("github.com/vooon/zoneomatic/internal/zone")
 
+// Update operations reported by zone metrics
+const (
+	OpDDNS = "ddns"
+	OpACME = "acme"
+	OpZM   = "zm"
+	OpPDNS = "pdns"
+)
+
+// Update results reported by zone metrics
+const (
+	ResultChanged   = "changed"
+	ResultUnchanged = "unchanged"
+	ResultError     = "error"
+)
+
+// ResultOK is the result of a successful git operation
+const ResultOK = "ok"
+
+// Zone file processing phases
+const (
+	phaseLoad   = "load"
+	phaseParse  = "parse"
+	phaseFormat = "format"
+	phaseWrite  = "write"
+)
+
+var zoneMetrics = newMetrics(otel.Meter("github.com/vooon/zoneomatic/internal/zone"))
+
+type metrics struct {
+	updates  metric.Int64Counter
+	duration metric.Float64Histogram
+	fileSize metric.Int64Histogram
+	git      metric.Int64Counter
+}
+
+func newMetrics(meter metric.Meter) *metrics {
+	m := &metrics{}
+
+	// NOTE: instrument errors only mean a noop instrument.
+	m.updates, _ = meter.Int64Counter("zoneomatic.zone.updates",
+		metric.WithDescription("Zone updates by operation and result"),
+		metric.WithUnit("{update}"),
+	)
+	m.duration, _ = meter.Float64Histogram("zoneomatic.zone.phase.duration",
+		metric.WithDescription("Duration of zone file load, parse, format and write of updates"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1),
+	)
+	m.fileSize, _ = meter.Int64Histogram("zoneomatic.zone.file.size",
+		metric.WithDescription("Zone file size on update load"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(1<<10, 4<<10, 16<<10, 64<<10, 256<<10, 1<<20, 4<<20),
+	)
+	m.git, _ = meter.Int64Counter("zoneomatic.zone.git.operations",
+		metric.WithDescription("Git commits and pushes of zone changes by result"),
+		metric.WithUnit("{operation}"),
+	)
+
+	return m
+}
+
+// recordUpdate counts a zone update with its result.
+func (m *metrics) recordUpdate(ctx context.Context, zone, op string, changed bool, err error) {
+	result := ResultUnchanged
+	switch {
+	case err != nil:
+		result = ResultError
+	case changed:
+		result = ResultChanged
+	}
+
+	m.updates.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("zone.name", zone),
+		attribute.String("zone.operation", op),
+		attribute.String("result", result),
+	))
+}
+
+func (m *metrics) recordPhase(ctx context.Context, zone, phase string, d time.Duration) {
+	m.duration.Record(ctx, d.Seconds(), metric.WithAttributes(
+		attribute.String("zone.name", zone),
+		attribute.String("zone.phase", phase),
+	))
+}
+
+func (m *metrics) recordFileSize(ctx context.Context, zone string, size int) {
+	m.fileSize.Record(ctx, int64(size), metric.WithAttributes(attribute.String("zone.name", zone)))
+}
+
+// recordGit counts a git commit or push.
+func (m *metrics) recordGit(ctx context.Context, op string, err error) {
+	result := ResultOK
+	if err != nil {
+		result = ResultError
+	}
+
+	m.git.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("git.operation", op),
+		attribute.String("result", result),
+	))
+}
+
 func recordSpanError(span trace.Span, err error) {
 	if err == nil {
 		return
@@ -0,0 +1,68 @@
+package zone
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/vooon/zoneomatic/internal/stats"
+)
+
+func TestZoneMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	prev := zoneMetrics
+	zoneMetrics = newMetrics(mp.Meter("test"))
+	t.Cleanup(func() { zoneMetrics = prev })
+
+	ctx := context.Background()
+	f := newZoneTemp(t, "./testdata/at.example.com.zone")
+	zoneName := normalizeZoneName(f.origin)
+	serial := stats.Default.Snapshot().Serials[zoneName]
+	require.NotZero(t, serial)
+
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+	require.NoError(t, f.UpdateDDNSAddress(ctx, "new-entry", []netip.Addr{netip.MustParseAddr("192.0.2.1")}))
+	_, err := f.ZMUpdateRecord(ctx, "missing", "A", 0, []string{"192.0.2.2"})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+	// reads are not updates
+	_, err = f.Snapshot(ctx)
+	require.NoError(t, err)
+
+	assert.Greater(t, stats.Default.Snapshot().Serials[zoneName], serial)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	byName := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m.Data
+	}
+
+	updates := map[string]int64{}
+	for _, dp := range byName["zoneomatic.zone.updates"].(metricdata.Sum[int64]).DataPoints {
+		op, _ := dp.Attributes.Value("zone.operation")
+		result, _ := dp.Attributes.Value("result")
+		updates[op.AsString()+"/"+result.AsString()] += dp.Value
+	}
+	assert.Equal(t, map[string]int64{"ddns/changed": 1, "ddns/unchanged": 1, "zm/error": 1}, updates)
+
+	phases := map[string]uint64{}
+	for _, dp := range byName["zoneomatic.zone.phase.duration"].(metricdata.Histogram[float64]).DataPoints {
+		phase, _ := dp.Attributes.Value("zone.phase")
+		phases[phase.AsString()] += dp.Count
+	}
+	// one load per update
+	assert.Equal(t, map[string]uint64{"load": 3, "parse": 3, "format": 1, "write": 1}, phases)
+
+	sizes := byName["zoneomatic.zone.file.size"].(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, sizes, 1)
+	assert.Equal(t, uint64(3), sizes[0].Count)
+}
@@ -0,0 +1,37 @@
+package zone
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/vooon/zoneomatic/pkg/fileutil"
+)
+
+// ErrVersionMismatch emitted if the zone is not at a version required by WithIfVersion
+var ErrVersionMismatch = errors.New("zone version does not match")
+
+type ifVersionKey struct{}
+
+// WithIfVersion makes updates in the context fail with ErrVersionMismatch,
+// unless the zone is at one of the versions (see ZoneSnapshot.Version) when loaded for update.
+func WithIfVersion(ctx context.Context, versions ...string) context.Context {
+	return context.WithValue(ctx, ifVersionKey{}, versions)
+}
+
+// zoneVersion identifies the file content, unlike the serial it also changes on edits keeping the serial.
+func zoneVersion(v fileutil.Version) string {
+	return hex.EncodeToString(v.Hash[:16])
+}
+
+// checkIfVersion checks the version loaded for update against WithIfVersion.
+func checkIfVersion(ctx context.Context, version string) error {
+	versions, ok := ctx.Value(ifVersionKey{}).([]string)
+	if !ok || slices.Contains(versions, version) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrVersionMismatch, version)
+}
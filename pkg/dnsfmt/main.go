@@ -10,6 +10,16 @@ import (
 )
 
 func Reformat(data, origin []byte, w io.Writer, incrementSerial bool) error {
+	var serial func([]byte) []byte
+	if incrementSerial {
+		serial = Increase
+	}
+
+	return ReformatSerial(data, origin, w, serial)
+}
+
+// ReformatSerial is Reformat which sets the SOA serial to serial(old). A nil serial keeps it.
+func ReformatSerial(data, origin []byte, w io.Writer, serial func([]byte) []byte) error {
 	origin = zonefile.Fqdn(origin)
 
 	zf, perr := zonefile.Load(data)
@@ -47,60 +57,12 @@ func Reformat(data, origin []byte, w io.Writer, incrementSerial bool) error {
 		}
 
 		// Strip origin from selected records.
-		values := e.Values()
-		switch e.RRType() {
-		case dns.TypeSOA:
-			if len(values) < 3 {
-				return fmt.Errorf("malformed SOA RR: %v", values)
-			}
-			if len(origin) == 0 { // $ORIGIN not set take from SOA
-				origin = zonefile.Fqdn(e.Domain())
-			}
-
-			if err := e.SetValue(0, StripOrigin(origin, values[0])); err != nil {
-				return fmt.Errorf("set SOA mname: %w", err)
-			}
-			if err := e.SetValue(1, StripOrigin(origin, values[1])); err != nil {
-				return fmt.Errorf("set SOA rname: %w", err)
-			}
-
-		case dns.TypeSRV:
-			if len(values) < 4 {
-				return fmt.Errorf("malformed SRV RR: %v", values)
-			}
-			if err := e.SetValue(3, StripOrigin(origin, values[3])); err != nil {
-				return fmt.Errorf("set SRV target: %w", err)
-			}
-
-		case dns.TypeRRSIG:
-			if len(values) < 8 {
-				return fmt.Errorf("malformed RRSIG RR: %v", values)
-			}
-			if err := e.SetValue(7, StripOrigin(origin, values[7])); err != nil {
-				return fmt.Errorf("set RRSIG signer: %w", err)
-			}
-
-		case dns.TypeMX:
-			if len(values) < 2 {
-				return fmt.Errorf("malformed MX RR: %v", values)
-			}
-			if err := e.SetValue(1, StripOrigin(origin, values[1])); err != nil {
-				return fmt.Errorf("set MX exchange: %w", err)
-			}
-
-		case dns.TypePTR:
-			fallthrough
-		case dns.TypeNS:
-			fallthrough
-		case dns.TypeCNAME:
-			fallthrough
-		case dns.TypeNSEC:
-			if len(values) < 1 {
-				return fmt.Errorf("malformed RR: %v", values)
-			}
-			if err := e.SetValue(0, StripOrigin(origin, values[0])); err != nil {
-				return fmt.Errorf("set rr target: %w", err)
-			}
+		if e.RRType() == dns.TypeSOA && len(e.Values()) >= 3 && len(origin) == 0 {
+			// $ORIGIN not set take from SOA
+			origin = zonefile.Fqdn(e.Domain())
+		}
+		if err := StripValuesOrigin(origin, &e); err != nil {
+			return err
 		}
 
 		if l := len(e.Domain()); l > longestname {
@@ -206,8 +168,8 @@ func Reformat(data, origin []byte, w io.Writer, incrementSerial bool) error {
 			fmt.Fprintf(w, "%s%s (\n", Space3, bytes.Join(values[:2], []byte(" ")))
 			for i, v := range values[2:] {
 				if i == 0 {
-					if incrementSerial {
-						v = Increase(v)
+					if serial != nil {
+						v = serial(v)
 					}
 					humandate := SerialToHuman(v)
 					fmt.Fprintf(w, "%-*s%s%-13s%s%s\n", longestname+Indent, " ", Space3, v, soacomment[i], humandate)
@@ -269,6 +231,64 @@ const (
 
 var soacomment = []string{"; serial", "; refresh", "; retry", "; expire", "; minimum"}
 
+// StripValuesOrigin strips origin from domain names in the record values,
+// the same way Reformat does for SOA, SRV, RRSIG, MX, PTR, NS, CNAME and NSEC.
+func StripValuesOrigin(origin []byte, e *zonefile.Entry) error {
+	values := e.Values()
+	switch e.RRType() {
+	case dns.TypeSOA:
+		if len(values) < 3 {
+			return fmt.Errorf("malformed SOA RR: %v", values)
+		}
+		if err := e.SetValue(0, StripOrigin(origin, values[0])); err != nil {
+			return fmt.Errorf("set SOA mname: %w", err)
+		}
+		if err := e.SetValue(1, StripOrigin(origin, values[1])); err != nil {
+			return fmt.Errorf("set SOA rname: %w", err)
+		}
+
+	case dns.TypeSRV:
+		if len(values) < 4 {
+			return fmt.Errorf("malformed SRV RR: %v", values)
+		}
+		if err := e.SetValue(3, StripOrigin(origin, values[3])); err != nil {
+			return fmt.Errorf("set SRV target: %w", err)
+		}
+
+	case dns.TypeRRSIG:
+		if len(values) < 8 {
+			return fmt.Errorf("malformed RRSIG RR: %v", values)
+		}
+		if err := e.SetValue(7, StripOrigin(origin, values[7])); err != nil {
+			return fmt.Errorf("set RRSIG signer: %w", err)
+		}
+
+	case dns.TypeMX:
+		if len(values) < 2 {
+			return fmt.Errorf("malformed MX RR: %v", values)
+		}
+		if err := e.SetValue(1, StripOrigin(origin, values[1])); err != nil {
+			return fmt.Errorf("set MX exchange: %w", err)
+		}
+
+	case dns.TypePTR:
+		fallthrough
+	case dns.TypeNS:
+		fallthrough
+	case dns.TypeCNAME:
+		fallthrough
+	case dns.TypeNSEC:
+		if len(values) < 1 {
+			return fmt.Errorf("malformed RR: %v", values)
+		}
+		if err := e.SetValue(0, StripOrigin(origin, values[0])); err != nil {
+			return fmt.Errorf("set rr target: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func closeBrace(w io.Writer, longestname int) {
 	fmt.Fprintf(w, "%-*s)\n", longestname+Indent+3, " ")
 }
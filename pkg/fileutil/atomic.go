@@ -3,8 +3,12 @@ package fileutil
 import (
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// tempSuffix marks temp files of AtomicWriteFile
+const tempSuffix = ".tmp-"
+
 // AtomicWriteFile writes data to filename using a temp file + rename.
 // If filename exists, its permission bits are preserved.
 func AtomicWriteFile(filename string, data []byte) error {
@@ -14,7 +18,7 @@ func AtomicWriteFile(filename string, data []byte) error {
 	}
 
 	dir := filepath.Dir(filename)
-	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp-*")
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+tempSuffix+"*")
 	if err != nil {
 		return err
 	}
@@ -39,3 +43,14 @@ func AtomicWriteFile(filename string, data []byte) error {
 
 	return os.Rename(tmpName, filename)
 }
+
+// CheckWritable checks that AtomicWriteFile can create its temp file next to filename.
+// Nothing is created, so it is cheap enough for frequent readiness probes.
+func CheckWritable(filename string) error {
+	return dirWritable(filepath.Dir(filename))
+}
+
+// IsTempFile reports if name looks like a temp file of AtomicWriteFile.
+func IsTempFile(name string) bool {
+	return strings.Contains(filepath.Base(name), tempSuffix)
+}
@@ -36,3 +36,35 @@ func TestAtomicWriteFile_PreservesMode(t *testing.T) {
 		t.Fatalf("unexpected mode: got %o want %o", got, want)
 	}
 }
+
+func TestCheckWritable(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := CheckWritable(filepath.Join(tmpDir, "zonefile.zone")); err != nil {
+		t.Fatalf("check writable: %v", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("temp file is left: %v", entries)
+	}
+
+	if err := CheckWritable(filepath.Join(tmpDir, "missing", "zonefile.zone")); err == nil {
+		t.Fatal("expected error for missing directory")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+
+	roDir := filepath.Join(tmpDir, "ro")
+	if err := os.Mkdir(roDir, 0500); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := CheckWritable(filepath.Join(roDir, "zonefile.zone")); err == nil {
+		t.Fatal("expected error for read-only directory")
+	}
+}
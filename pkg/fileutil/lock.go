@@ -0,0 +1,64 @@
+package fileutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout emitted if the lock is held by someone else for too long
+var ErrLockTimeout = errors.New("timeout waiting for file lock")
+
+// lockRetryInterval is the poll interval of a busy lock
+const lockRetryInterval = 20 * time.Millisecond
+
+// LockPath returns the lock file of filename, a hidden file next to it.
+//
+// The file itself can not be locked: AtomicWriteFile replaces it,
+// so a lock held on the old inode does not stop writers of the new one.
+func LockPath(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, "."+base+".lock")
+}
+
+// Lock takes an exclusive advisory lock (flock) of the LockPath of filename.
+// It waits up to timeout, or until ctx is done.
+// The lock file is kept after unlock, removing it would race with other lockers.
+func Lock(ctx context.Context, filename string, timeout time.Duration) (unlock func() error, err error) {
+	fd, err := os.OpenFile(LockPath(filename), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := tryLock(fd)
+		if err != nil {
+			_ = fd.Close()
+			return nil, err
+		}
+		if ok {
+			return func() error {
+				// closing the descriptor releases the lock
+				return fd.Close()
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = fd.Close()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrLockTimeout
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fileutil
+
+import "os"
+
+// tryLock is a no-op, flock is not available.
+func tryLock(_ *os.File) (bool, error) {
+	return true, nil
+}
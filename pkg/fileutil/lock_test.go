@@ -0,0 +1,44 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+	ctx := context.Background()
+
+	unlock, err := Lock(ctx, filename, time.Second)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	// flock conflicts between descriptors, also in the same process
+	if _, err := Lock(ctx, filename, 50*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected lock timeout, got: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		unlock2, err := Lock(ctx, filename, time.Second)
+		if err == nil {
+			err = unlock2()
+		}
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+}
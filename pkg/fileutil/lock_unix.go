@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func tryLock(fd *os.File) (bool, error) {
+	err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
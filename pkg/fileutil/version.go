@@ -0,0 +1,63 @@
+package fileutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrFileChanged emitted if the file is not the expected version anymore
+var ErrFileChanged = errors.New("file changed")
+
+// Version identifies the file content, to detect changes by other writers.
+type Version struct {
+	Hash    [sha256.Size]byte
+	Size    int64
+	ModTime time.Time
+	// Inode changes on replace by rename, 0 if unknown
+	Inode uint64
+}
+
+// ReadFileVersion reads the file with its version.
+// Both come from the same descriptor, so they match even if the file is replaced meanwhile.
+func ReadFileVersion(filename string) ([]byte, Version, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, Version{}, err
+	}
+	defer fd.Close() // nolint:errcheck
+
+	st, err := fd.Stat()
+	if err != nil {
+		return nil, Version{}, err
+	}
+
+	data, err := io.ReadAll(fd)
+	if err != nil {
+		return nil, Version{}, err
+	}
+
+	return data, Version{
+		Hash:    sha256.Sum256(data),
+		Size:    st.Size(),
+		ModTime: st.ModTime(),
+		Inode:   inode(st),
+	}, nil
+}
+
+// CheckVersion returns ErrFileChanged if the file differs from v.
+// The content is compared too, mtime resolution may hide a quick edit.
+func CheckVersion(filename string, v Version) error {
+	_, cur, err := ReadFileVersion(filename)
+	if err != nil {
+		return err
+	}
+
+	if cur.Inode != v.Inode || cur.Size != v.Size || !cur.ModTime.Equal(v.ModTime) || cur.Hash != v.Hash {
+		return ErrFileChanged
+	}
+
+	return nil
+}
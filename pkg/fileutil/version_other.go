@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fileutil
+
+import "os"
+
+func inode(_ os.FileInfo) uint64 {
+	return 0
+}
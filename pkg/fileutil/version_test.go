@@ -0,0 +1,55 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVersion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+	if err := os.WriteFile(filename, []byte("old"), 0600); err != nil {
+		t.Fatalf("write initial file: %v", err)
+	}
+
+	data, v, err := ReadFileVersion(filename)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(data) != "old" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+
+	if err := CheckVersion(filename, v); err != nil {
+		t.Fatalf("unchanged file: %v", err)
+	}
+
+	// same size and mtime, only the content differs
+	st, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if err := os.WriteFile(filename, []byte("new"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chtimes(filename, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	if err := CheckVersion(filename, v); !errors.Is(err, ErrFileChanged) {
+		t.Fatalf("expected changed file, got: %v", err)
+	}
+
+	_, v, err = ReadFileVersion(filename)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := AtomicWriteFile(filename, []byte("new")); err != nil {
+		t.Fatalf("atomic write: %v", err)
+	}
+
+	if err := CheckVersion(filename, v); !errors.Is(err, ErrFileChanged) {
+		t.Fatalf("expected replaced file, got: %v", err)
+	}
+}
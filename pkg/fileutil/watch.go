@@ -0,0 +1,102 @@
+package fileutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statStamp(filename string) fileStamp {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return fileStamp{}
+	}
+
+	return fileStamp{exists: true, size: st.Size(), modTime: st.ModTime()}
+}
+
+// WatchFile polls the file every interval and calls onChange
+// when its modification time or size changes, including file removal.
+// It blocks until ctx is done.
+func WatchFile(ctx context.Context, filename string, interval time.Duration, onChange func()) {
+	prev := statStamp(filename)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur := statStamp(filename)
+		if cur != prev {
+			prev = cur
+			onChange()
+		}
+	}
+}
+
+// GlobDir returns sorted paths of regular files in dir with names matching pattern.
+// Hidden files and temp files of AtomicWriteFile are skipped.
+func GlobDir(dir, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(entries))
+	for _, ent := range entries {
+		name := ent.Name()
+		if !ent.Type().IsRegular() || strings.HasPrefix(name, ".") || IsTempFile(name) {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			ret = append(ret, filepath.Join(dir, name))
+		}
+	}
+
+	return ret, nil
+}
+
+// WatchDir polls dir every interval and calls onChange
+// when the list of files matching pattern changes.
+// It blocks until ctx is done.
+func WatchDir(ctx context.Context, dir, pattern string, interval time.Duration, onChange func()) {
+	prev, _ := GlobDir(dir, pattern)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := GlobDir(dir, pattern)
+		if err != nil {
+			continue
+		}
+		if !slices.Equal(cur, prev) {
+			prev = cur
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package fileutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(filename, []byte("old"), 0600); err != nil {
+		t.Fatalf("write initial file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 10)
+	go WatchFile(ctx, filename, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	select {
+	case <-changed:
+		t.Fatalf("unexpected change before file write")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := AtomicWriteFile(filename, []byte("new content")); err != nil {
+		t.Fatalf("atomic write: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("change not detected")
+	}
+}
+
+func TestGlobDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"db.example.com", "db.example.org", ".db.hidden", "db.example.com.tmp-123", "example.net.zone"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "db.dir"), 0700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	files, err := GlobDir(dir, "db.*")
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+
+	expected := []string{filepath.Join(dir, "db.example.com"), filepath.Join(dir, "db.example.org")}
+	if !slices.Equal(files, expected) {
+		t.Fatalf("unexpected files: %v", files)
+	}
+
+	if _, err := GlobDir(dir, "["); err == nil {
+		t.Fatalf("expected bad pattern error")
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "example.com.zone")
+	if err := os.WriteFile(existing, []byte("old"), 0600); err != nil {
+		t.Fatalf("write initial file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 10)
+	go WatchDir(ctx, dir, "*.zone", 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	// rewrites of known files are not a change of the list
+	if err := AtomicWriteFile(existing, []byte("new content")); err != nil {
+		t.Fatalf("atomic write: %v", err)
+	}
+
+	select {
+	case <-changed:
+		t.Fatalf("unexpected change on file write")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "example.org.zone"), nil, 0600); err != nil {
+		t.Fatalf("write new file: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("new file not detected")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// dirWritable only checks that the directory exists, permissions are not known here.
+func dirWritable(dir string) error {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return &os.PathError{Op: "stat", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// access(2) modes, the same on all unixes
+const (
+	accessExec  = 0x1
+	accessWrite = 0x2
+)
+
+// dirWritable checks that files can be created in the directory.
+func dirWritable(dir string) error {
+	if err := syscall.Access(dir, accessWrite|accessExec); err != nil {
+		return &os.PathError{Op: "access", Path: dir, Err: err}
+	}
+
+	return nil
+}
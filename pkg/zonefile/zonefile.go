@@ -104,6 +104,11 @@ func (e Entry) Equal(e2 Entry) bool {
 		return false
 	}
 
+	// disabled records are comments, inline comments of records do not matter
+	if e.IsComment && !slices.EqualFunc(e.Comments(), e2.Comments(), bytes.Equal) {
+		return false
+	}
+
 	ttl1 := e.TTL()
 	ttl2 := e2.TTL()
 	if ttl1 == nil && ttl2 == nil {
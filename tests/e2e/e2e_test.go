@@ -92,6 +92,29 @@ func TestZoneomaticPDNSE2E(t *testing.T) {
 		assert.Contains(t, string(zoneBuf), "192.0.2.55")
 	})
 
+	t.Run("conditional zone read and patch", func(t *testing.T) {
+		zoneURL := srv.baseURL + "/api/v1/servers/localhost/zones/at.example.com."
+		resp := httpDo(t, client, http.MethodGet, zoneURL, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		resp = httpDoHeader(t, client, http.MethodGet, zoneURL, nil, "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		payload := `{"rrsets":[{"name":"etag.at.example.com.","type":"A","ttl":120,"changetype":"REPLACE","records":[{"content":"192.0.2.56","disabled":false}]}]}`
+		resp = httpDoHeader(t, client, http.MethodPatch, zoneURL, strings.NewReader(payload), "If-Match", etag)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		// the zone changed, so the old ETag is stale
+		resp = httpDoHeader(t, client, http.MethodPatch, zoneURL, strings.NewReader(payload), "If-Match", etag)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp = httpDoHeader(t, client, http.MethodGet, zoneURL, nil, "If-None-Match", etag)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	})
+
 	t.Run("unsupported zone create", func(t *testing.T) {
 		resp := httpDo(t, client, http.MethodPost, srv.baseURL+"/api/v1/servers/localhost/zones", nil)
 		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
@@ -129,7 +152,8 @@ func startZoneomatic(t *testing.T) *runningServer {
 		"--listen", listenAddr,
 		"--debug",
 	)
-	cmd.Dir = repoRoot
+	// the server writes doc/openapi.json to its working directory, keep it out of the repository
+	cmd.Dir = t.TempDir()
 	cmd.Stdout = logs
 	cmd.Stderr = logs
 
@@ -254,12 +278,22 @@ func freeListenAddr(t *testing.T) string {
 func httpDo(t *testing.T, client *http.Client, method, url string, body io.Reader) *http.Response {
 	t.Helper()
 
+	return httpDoHeader(t, client, method, url, body)
+}
+
+// httpDoHeader sends the request with extra headers, given as key, value pairs.
+func httpDoHeader(t *testing.T, client *http.Client, method, url string, body io.Reader, header ...string) *http.Response {
+	t.Helper()
+
 	req, err := http.NewRequest(method, url, body)
 	require.NoError(t, err)
 	req.Header.Set("X-API-Key", pdnsAPIKey("e2e", e2eAPIKey))
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
 
 	resp, err := client.Do(req)
 	require.NoError(t, err)